@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"nodeid/internal/config"
+
+	"github.com/pkg/errors"
+)
+
+// runConfig nodeid config validate <file>..., 所有文件都合法时返回0
+func runConfig(args []string) int {
+	if len(args) < 2 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "usage: nodeid config validate <file>...")
+		return 2
+	}
+
+	code := 0
+	for _, file := range args[1:] {
+		err := config.ValidateFile(file)
+		if err == nil {
+			fmt.Printf("%s: ok\n", file)
+			continue
+		}
+
+		code = 1
+		var verr config.ValidationError
+		if !errors.As(err, &verr) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			continue
+		}
+		for _, msg := range verr {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, msg)
+		}
+	}
+	return code
+}
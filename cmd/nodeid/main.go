@@ -2,40 +2,39 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 
-	"nodeid/internal/app"
-	"nodeid/pkg/log"
+	"nodeid/internal/cli"
 )
 
 func main() {
-	log.Init()
-	srv, err := app.New(
-		app.Conf(),
-		app.LogLevel(),
-		app.Named(),
-		app.Dao(),
-		app.UseCase(),
-		app.Controller(),
-		app.Router(),
-		app.PProf(),
-		app.HTTPServer(),
-	)
-
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		return
+	// 没有子命令时启动服务, 兼容原来的用法
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
 
-	log.Info().Msg("app init success")
-
-	// 监听信号
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
-
-	_ = srv.Run(ch)
+	switch {
+	case cmd == "serve":
+		os.Exit(serve(args))
+	case cmd == "config":
+		os.Exit(runConfig(args))
+	case cli.IsCommand(cmd):
+		os.Exit(cli.Run(cmd, args))
+	case cmd == "help":
+		usage(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+}
 
-	<-ch
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage:")
+	fmt.Fprintln(w, "  nodeid [serve] [--config file] [flags]")
+	fmt.Fprintln(w, "  nodeid config validate <file>...")
+	cli.Usage(w)
 }
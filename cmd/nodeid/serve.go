@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"nodeid/internal/app"
+	"nodeid/internal/config"
+	"nodeid/pkg/log"
+)
+
+// serve 启动服务, 收到退出信号后返回退出码
+func serve(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	config.RegisterFlags(fs)
+	_ = fs.Parse(args)
+
+	log.Init()
+	srv, err := app.New(
+		app.Conf(),
+		app.LogLevel(),
+		app.Tracer(),
+		app.Webhook(),
+		app.Named(),
+		app.Audit(),
+		app.Dao(),
+		app.UseCase(),
+		app.Controller(),
+		app.Router(),
+		app.PProf(),
+		app.Metrics(),
+		app.HTTPServer(),
+		app.Reload(),
+	)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	log.Info().Msg("app init success")
+
+	// 监听信号
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+
+	_ = srv.Run(ch)
+
+	code := 0
+	if sig, ok := <-ch; ok {
+		log.Info().Str("signal", sig.String()).Msg("app is stopping")
+		signal.Stop(ch)
+	} else {
+		// http服务异常退出
+		code = 1
+	}
+
+	if err := srv.Stop(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		code = 1
+	}
+
+	return code
+}
@@ -3,8 +3,12 @@ module nodeid
 go 1.14
 
 require (
-	github.com/boltdb/bolt v1.3.1 // indirect
+	github.com/BurntSushi/toml v0.4.1
+	github.com/boltdb/bolt v1.3.1
+	github.com/coreos/etcd v3.3.27+incompatible
+	github.com/coreos/go-semver v0.3.0
 	github.com/docker/libkv v0.2.1
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/gin-contrib/cors v1.3.1
 	github.com/gin-contrib/pprof v1.3.0
 	github.com/gin-gonic/gin v1.6.3
@@ -12,6 +16,13 @@ require (
 	github.com/juju/ratelimit v1.0.1 // indirect
 	github.com/julianshen/gin-limiter v0.0.0-20161123033831-fc39b5e90fe7
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.11.1
 	github.com/rs/zerolog v1.20.0
-	github.com/stretchr/testify v1.5.1
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.3.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.3.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.3.0
+	go.opentelemetry.io/otel/sdk v1.3.0
+	go.opentelemetry.io/otel/trace v1.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -1,22 +1,36 @@
 package app
 
 import (
+	"context"
 	"net"
 	"net/http"
+	"nodeid/internal/audit"
 	"nodeid/internal/config"
 	"nodeid/internal/controller"
+	httpCtrl "nodeid/internal/controller/http"
 	"nodeid/internal/service"
 	"nodeid/internal/store"
+	"nodeid/internal/webhook"
+	"nodeid/pkg/middleware"
 	"nodeid/pkg/nid"
+	"nodeid/pkg/tracing"
 	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	plog "nodeid/pkg/log"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 )
 
 // 常量定义
 const (
 	ServiceID = 110
+
+	defaultShutdownTimeout = 5 * time.Second
 )
 
 // App ...
@@ -48,6 +62,25 @@ type app struct {
 	useCase service.UseCase
 	dao     store.Dao
 	named   nid.NodeNamed
+
+	// mirror 迁移期间双写的后端
+	mirror nid.NodeNamed
+
+	traceShutdown tracing.Shutdown
+	webhook       *webhook.Dispatcher
+	audit         *audit.Recorder
+	limiter       *middleware.DynamicRateLimiter
+	auth          *httpCtrl.Authenticator
+}
+
+// onEvent 把编号事件转发给审计日志和webhook
+func (s *app) onEvent(ctx context.Context, ev *nid.Event) {
+	if s.audit != nil {
+		s.audit.OnEvent(ctx, ev)
+	}
+	if s.webhook != nil {
+		s.webhook.Publish(ctx, ev)
+	}
 }
 
 func (s *app) GetServiceID() int {
@@ -62,11 +95,13 @@ func (s *app) GetLocalIP() string {
 }
 
 // Run ...
+// http服务异常退出时关闭ch, 通知调用方
 func (s *app) Run(ch chan os.Signal) error {
 	// Run server
 	go func() {
-		if err := s.httpSrv.ListenAndServe(); err != nil {
+		if err := s.httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Error().Err(err).Msg("http app exit")
+			signal.Stop(ch)
 			close(ch)
 		}
 	}()
@@ -74,8 +109,58 @@ func (s *app) Run(ch chan os.Signal) error {
 	return nil
 }
 
-// Stop ...
+// Stop 等待进行中的请求处理完成, 然后释放后端连接、trace和日志
 func (s *app) Stop() error {
+	// shutdownTimeout修改后需要重启才生效, 使用启动时的配置
+	timeout := defaultShutdownTimeout
+	if s.conf != nil && s.conf.GetShutdownTimeout() > 0 {
+		timeout = time.Duration(s.conf.GetShutdownTimeout()) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []string
+	if s.httpSrv != nil {
+		if err := s.httpSrv.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("http server shutdown")
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if s.named != nil {
+		s.named.Close()
+	}
+	if s.mirror != nil {
+		s.mirror.Close()
+	}
+
+	if s.webhook != nil {
+		if err := s.webhook.Close(); err != nil {
+			log.Error().Err(err).Msg("webhook close")
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if s.audit != nil {
+		if err := s.audit.Close(); err != nil {
+			log.Error().Err(err).Msg("audit close")
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if s.traceShutdown != nil {
+		if err := s.traceShutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("trace shutdown")
+			errs = append(errs, err.Error())
+		}
+	}
+
+	log.Info().Msg("app stopped")
+	plog.Close()
+
+	if len(errs) > 0 {
+		return errors.Errorf("stop app: %s", strings.Join(errs, "; "))
+	}
 	return nil
 }
 
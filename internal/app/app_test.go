@@ -0,0 +1,86 @@
+package app
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestStopWaitsForRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = w.Write([]byte("done"))
+	})
+	addr := freeAddr(t)
+	s := &app{httpSrv: &http.Server{Addr: addr, Handler: mux}}
+	assert.NoError(t, s.Run(make(chan os.Signal, 1)))
+
+	body := make(chan string, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		// 等待服务开始监听
+		for i := 0; i < 100; i++ {
+			if resp, err = http.Get("http://" + addr + "/slow"); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !assert.NoError(t, err) {
+			body <- ""
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Stop() }()
+
+	// 进行中的请求完成前Stop不返回
+	select {
+	case <-stopped:
+		t.Fatal("stop returned before the request finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	assert.Equal(t, "done", <-body)
+	assert.NoError(t, <-stopped)
+
+	_, err := http.Get("http://" + addr + "/slow")
+	assert.Error(t, err)
+}
+
+func TestRunListenError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	// 端口被占用时关闭ch通知调用方
+	ch := make(chan os.Signal, 1)
+	s := &app{httpSrv: &http.Server{Addr: l.Addr().String()}}
+	assert.NoError(t, s.Run(ch))
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("channel not closed")
+	}
+}
@@ -8,17 +8,21 @@ import (
 	"reflect"
 	"time"
 
+	"nodeid/internal/audit"
 	"nodeid/internal/config"
 	"nodeid/internal/controller"
 	httpCtrl "nodeid/internal/controller/http"
 	"nodeid/internal/service"
+	"nodeid/internal/webhook"
 	"nodeid/pkg/log"
 	"nodeid/pkg/middleware"
+	"nodeid/pkg/tracing"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Option ...
@@ -31,6 +35,9 @@ func Conf() Option {
 		value := reflect.ValueOf(a.conf)
 		if value.IsNil() {
 			err = errors.New("config init failed")
+			if e := config.LoadError(); e != nil {
+				err = errors.Wrap(e, "config init failed")
+			}
 			return
 		}
 
@@ -49,7 +56,11 @@ func LogLevel() Option {
 // UseCase ...
 func UseCase() Option {
 	return func(a *app) (err error) {
-		a.useCase = service.NewUseCase(a.dao)
+		a.useCase = service.NewUseCase(a.dao,
+			service.WithQuota(quotaOf(a.conf)),
+			service.RequireRegistration(a.conf.IsRegistrationRequired()),
+			service.WithAudit(a.audit),
+		)
 		if a.useCase == nil {
 			return errors.New("create UseCase failed")
 		}
@@ -61,7 +72,8 @@ func UseCase() Option {
 // Controller ...
 func Controller() Option {
 	return func(a *app) (err error) {
-		a.ctrl = httpCtrl.NewHttpController(a.useCase)
+		timeout := time.Duration(a.conf.GetRequestTimeout()) * time.Millisecond
+		a.ctrl = httpCtrl.NewHttpController(a.useCase, timeout)
 		if a.ctrl == nil {
 			return errors.New("create Controller failed")
 		}
@@ -92,7 +104,15 @@ func Router() Option {
 			a.router = gin.New()
 			a.router.Use(gin.Recovery(), cors.Default())
 		}
-		a.router.Use(middleware.NewRateLimiter(time.Second, 5000))
+		a.limiter = middleware.NewDynamicRateLimiter(time.Second, rateLimit(a.conf))
+		a.auth = httpCtrl.NewAuthenticator(identities(a.conf))
+		a.router.Use(
+			middleware.NewMetrics(),
+			middleware.NewTracing(),
+			httpCtrl.ProblemOnAbort("/named/v2"),
+			a.limiter.Middleware(),
+			a.auth.Middleware(),
+		)
 		if a.router == nil {
 			return errors.New("gin router is nil")
 		}
@@ -116,6 +136,22 @@ func PProf() Option {
 	}
 }
 
+// Tracer ...
+func Tracer() Option {
+	return func(a *app) (err error) {
+		a.traceShutdown, err = tracing.Init(a.conf.GetServerName(), a.conf.GetTraceExporter(), a.conf.GetTraceEndpoint())
+		return
+	}
+}
+
+// Metrics ...
+func Metrics() Option {
+	return func(a *app) (err error) {
+		a.router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+		return
+	}
+}
+
 // HTTPServer ...
 func HTTPServer() Option {
 	return func(a *app) (err error) {
@@ -128,12 +164,72 @@ func HTTPServer() Option {
 	}
 }
 
+// Webhook 需要在Named之前初始化
+func Webhook() Option {
+	return func(a *app) (err error) {
+		conf := a.conf.GetWebhook()
+		if len(conf.Endpoints) == 0 {
+			return
+		}
+
+		endpoints := make([]*webhook.Endpoint, 0, len(conf.Endpoints))
+		for _, e := range conf.Endpoints {
+			endpoints = append(endpoints, &webhook.Endpoint{URL: e.URL, Secret: e.Secret, Events: e.Events})
+		}
+		a.webhook, err = webhook.New(conf.Queue, endpoints,
+			time.Duration(conf.Timeout)*time.Millisecond, conf.MaxAttempts)
+		return
+	}
+}
+
+// Named 配置了mirror时, 每次写入后同步写入mirror, 用于迁移后端
 func Named() Option {
 	return func(a *app) (err error) {
-		a.named, err = nid.NewConsulNamed(a.conf.GetConsulAddr())
-		if err != nil {
-			return err
+		opts := []nid.Option{
+			nid.IdempotencyWindow(time.Duration(a.conf.GetIdempotencyWindow()) * time.Second),
+			nid.HistorySize(a.conf.GetHistorySize()),
+			nid.OnEvent(a.onEvent),
 		}
-		return nil
+		if m := a.conf.GetMirror(); m.Backend != "" {
+			if a.mirror, err = nid.Open(m.Backend, m.Addr); err != nil {
+				return errors.Wrap(err, "open mirror")
+			}
+			opts = append(opts, nid.MirrorTo(a.mirror, func(key string, err error) {
+				log.Error().Err(err).Str("key", key).Msg("mirror record failed")
+			}))
+		}
+
+		conf := a.conf.GetStore()
+		a.named, err = nid.Open(conf.Backend, conf.Addr, opts...)
+		return err
+	}
+}
+
+// defaultAuditRetention audit.retentionDays为0时审计记录的保留时间
+const defaultAuditRetention = 30 * 24 * time.Hour
+
+// Audit 需要在Named之后、UseCase之前初始化
+func Audit() Option {
+	return func(a *app) (err error) {
+		var s audit.Store
+		conf := a.conf.GetAudit()
+		retention := time.Duration(conf.RetentionDays) * 24 * time.Hour
+		if conf.RetentionDays == 0 {
+			retention = defaultAuditRetention
+		}
+		switch conf.Backend {
+		case "":
+			return
+		case "kv":
+			s = audit.NewKVStore(a.named, retention)
+		case "bolt":
+			if s, err = audit.NewBoltStore(conf.Path, retention); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("unknown audit backend %q", conf.Backend)
+		}
+		a.audit = audit.NewRecorder(s)
+		return
 	}
 }
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"nodeid/internal/config"
+	httpCtrl "nodeid/internal/controller/http"
+	"nodeid/internal/service"
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsWithoutToken(t *testing.T) {
+	named, err := nid.NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoError(t, err)
+	s := &app{
+		conf: &testConf{auth: config.AuthConf{Tokens: []config.AuthToken{{Token: "t", Name: "ops"}}}},
+		ctrl: httpCtrl.NewHttpController(service.NewUseCase(store.NewDao(named)), 0),
+	}
+	assert.NoError(t, Router()(s))
+	assert.NoError(t, Metrics()(s))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	assert.Contains(t, get("/named/v1/foo/nodeid?ip=127.0.0.1").Body.String(),
+		`"errCode":`+strconv.Itoa(httpCtrl.CodeAccessToken))
+
+	// 配置token后prometheus仍然可以抓取指标
+	w := get("/metrics")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "nodeid_http_requests_total")
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"strings"
+	"time"
+
+	"nodeid/internal/config"
+	httpCtrl "nodeid/internal/controller/http"
+	"nodeid/internal/service"
+	"nodeid/pkg/log"
+)
+
+const defaultRateLimit = 5000
+
+// reloadable 修改后立即生效的配置项, 其他配置项需要重启
+var reloadable = []string{"logLevel", "rateLimit", "quota", "requireRegistration", "auth"}
+
+// Reload 订阅配置变更, 需要在UseCase和Router之后初始化
+func Reload() Option {
+	return func(a *app) (err error) {
+		config.Subscribe(a.onConfChange)
+		return
+	}
+}
+
+func (s *app) onConfChange(ch *config.Change) {
+	conf := ch.New
+	if ch.Has("logLevel") {
+		log.SetLevel(conf.GetLogLevel())
+	}
+
+	if ch.Has("rateLimit") && s.limiter != nil {
+		s.limiter.Set(time.Second, rateLimit(conf))
+	}
+
+	if ch.Has("auth") && s.auth != nil {
+		s.auth.Set(identities(conf))
+	}
+
+	if ch.Has("quota") || ch.Has("requireRegistration") {
+		s.useCase.Reconfigure(
+			service.WithQuota(quotaOf(conf)),
+			service.RequireRegistration(conf.IsRegistrationRequired()),
+		)
+	}
+
+	var restart []string
+	for _, key := range ch.Keys {
+		if !isReloadable(key) {
+			restart = append(restart, key)
+		}
+	}
+	log.Info().Strs("keys", ch.Keys).Msg("config reloaded")
+	if len(restart) > 0 {
+		log.Warn().Strs("keys", restart).Msg("config changes take effect after restart")
+	}
+}
+
+func isReloadable(key string) bool {
+	for _, k := range reloadable {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimit 0使用默认值, 负数表示不限流
+func rateLimit(conf config.Conf) int64 {
+	n := conf.GetRateLimit()
+	if n == 0 {
+		n = defaultRateLimit
+	}
+	return int64(n)
+}
+
+// identities 按token索引鉴权配置
+func identities(conf config.Conf) map[string]*httpCtrl.Identity {
+	tokens := conf.GetAuth().Tokens
+	ids := make(map[string]*httpCtrl.Identity, len(tokens))
+	for _, t := range tokens {
+		ids[t.Token] = &httpCtrl.Identity{Name: t.Name, Tenant: t.Tenant, Admin: t.Admin}
+	}
+	return ids
+}
+
+func quotaOf(conf config.Conf) *service.Quota {
+	q := conf.GetQuota()
+	return &service.Quota{
+		Service:  q.Service,
+		Tenant:   q.Tenant,
+		Services: q.Services,
+		Tenants:  q.Tenants,
+	}
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nodeid/internal/config"
+	httpCtrl "nodeid/internal/controller/http"
+	"nodeid/internal/service"
+	"nodeid/internal/store"
+	"nodeid/pkg/middleware"
+	"nodeid/pkg/nid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConf 只实现重新加载时读取的配置项
+type testConf struct {
+	config.Conf
+	rateLimit int
+	quota     config.QuotaConf
+	auth      config.AuthConf
+}
+
+func (c *testConf) GetRateLimit() int            { return c.rateLimit }
+func (c *testConf) GetQuota() config.QuotaConf   { return c.quota }
+func (c *testConf) GetAuth() config.AuthConf     { return c.auth }
+func (c *testConf) IsRegistrationRequired() bool { return false }
+func (c *testConf) GetLogLevel() int             { return 1 }
+func (c *testConf) IsDebugMode() bool            { return false }
+
+func TestOnConfChange(t *testing.T) {
+	named, err := nid.NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoError(t, err)
+	s := &app{
+		limiter: middleware.NewDynamicRateLimiter(time.Second, 0),
+		auth:    httpCtrl.NewAuthenticator(nil),
+		useCase: service.NewUseCase(store.NewDao(named)),
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(s.limiter.Middleware(), s.auth.Middleware())
+	r.GET("/ping", func(ctx *gin.Context) { ctx.String(http.StatusOK, "pong") })
+	ping := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, "pong", ping("").Body.String())
+
+	conf := &testConf{
+		rateLimit: 2,
+		quota:     config.QuotaConf{Service: 1},
+		auth:      config.AuthConf{Tokens: []config.AuthToken{{Token: "t", Name: "ops"}}},
+	}
+	s.onConfChange(&config.Change{New: conf, Keys: []string{"rateLimit", "quota.service", "auth.tokens"}})
+
+	// 修改后的鉴权、限流和配额立即生效
+	assert.NotEqual(t, "pong", ping("").Body.String())
+	assert.Equal(t, "pong", ping("t").Body.String())
+	assert.Equal(t, http.StatusTooManyRequests, ping("t").Code)
+
+	ctx := context.Background()
+	req := func(i int) *store.NodeRequest {
+		return &store.NodeRequest{Service: "foo", Addr: "127.0.0.1", Path: fmt.Sprintf("/app/%d", i)}
+	}
+	_, err = s.useCase.GetNodeID(ctx, req(0))
+	assert.NoError(t, err)
+	_, err = s.useCase.GetNodeID(ctx, req(1))
+	assert.Truef(t, errors.Is(err, service.ErrQuotaExceeded), "unexpected error: %v", err)
+}
+
+func TestIsReloadable(t *testing.T) {
+	assert.True(t, isReloadable("quota.services"))
+	assert.True(t, isReloadable("auth.tokens"))
+	assert.False(t, isReloadable("httpPort"))
+	assert.False(t, isReloadable("quotaX"))
+}
@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"nodeid/internal/store"
+	"nodeid/pkg/log"
+	"nodeid/pkg/nid"
+)
+
+// 管理操作, 编号相关的操作使用nid.Event的类型
+const (
+	ActionServiceCreate = "service.create"
+	ActionServiceUpdate = "service.update"
+	ActionServiceDelete = "service.delete"
+)
+
+// Entry 一条审计记录, 写入后不再修改
+type Entry struct {
+	ID       string          `json:"id"`
+	Time     time.Time       `json:"time"`
+	Actor    string          `json:"actor"`
+	Claimed  string          `json:"claimedActor,omitempty"` // X-Actor请求头中声明的操作者, 未经验证
+	Action   string          `json:"action"`
+	Tenant   string          `json:"tenant,omitempty"`
+	Service  string          `json:"service"`
+	NodeID   int             `json:"nodeId,omitempty"`
+	Holder   *nid.NameHolder `json:"holder,omitempty"`
+	Previous *nid.NameHolder `json:"previous,omitempty"`
+	Detail   string          `json:"detail,omitempty"`
+}
+
+// Filter 查询条件, 除Tenant外零值表示不限制. Tenant为空表示默认租户, AllTenants为true时查询所有租户
+type Filter struct {
+	Tenant     string
+	AllTenants bool
+	Service    string
+	NodeID     int
+	IP         string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+func (f *Filter) match(e *Entry) bool {
+	switch {
+	case !f.AllTenants && e.Tenant != f.Tenant,
+		f.Service != "" && e.Service != f.Service,
+		f.NodeID != 0 && e.NodeID != f.NodeID,
+		!f.From.IsZero() && e.Time.Before(f.From),
+		!f.To.IsZero() && e.Time.After(f.To):
+		return false
+	}
+
+	if f.IP == "" {
+		return true
+	}
+	return (e.Holder != nil && e.Holder.LocalIP == f.IP) ||
+		(e.Previous != nil && e.Previous.LocalIP == f.IP)
+}
+
+// Store 审计记录的存储, 只能追加
+type Store interface {
+	Append(ctx context.Context, e *Entry) error
+	// Query 按时间顺序返回符合条件的记录, 超过Limit时返回最新的Limit条
+	Query(ctx context.Context, f *Filter) ([]*Entry, error)
+	Close() error
+}
+
+type actorKey struct{}
+
+type actor struct {
+	name, claimed string
+}
+
+// WithActor 在ctx中记录操作者, name为鉴权得到的身份或客户端ip, claimed为调用方自己声明的操作者
+func WithActor(ctx context.Context, name, claimed string) context.Context {
+	return context.WithValue(ctx, actorKey{}, &actor{name, claimed})
+}
+
+// ActorFrom 返回操作者及其声明的操作者
+func ActorFrom(ctx context.Context) (name, claimed string) {
+	if a, ok := ctx.Value(actorKey{}).(*actor); ok {
+		return a.name, a.claimed
+	}
+	return "", ""
+}
+
+// Recorder 记录编号事件和管理操作
+type Recorder struct {
+	store Store
+}
+
+// NewRecorder ...
+func NewRecorder(s Store) *Recorder {
+	return &Recorder{store: s}
+}
+
+// OnEvent 可以直接作为nid.Listener, 记录所有编号事件. 续约不产生事件
+func (r *Recorder) OnEvent(ctx context.Context, ev *nid.Event) {
+	tenant, service, _ := store.ParseServiceKey(ev.ServiceKey)
+	r.Record(ctx, &Entry{
+		Time:     ev.Time,
+		Action:   ev.Type,
+		Tenant:   tenant,
+		Service:  service,
+		NodeID:   ev.NodeID,
+		Holder:   ev.Holder,
+		Previous: ev.Previous,
+	})
+}
+
+// Record 补充操作者和时间后写入, 失败只记录日志, 不影响业务
+func (r *Recorder) Record(ctx context.Context, e *Entry) {
+	if e.Actor == "" {
+		e.Actor, e.Claimed = ActorFrom(ctx)
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if err := r.store.Append(ctx, e); err != nil {
+		log.Error().Err(err).Str("action", e.Action).Str("service", e.Service).Msg("audit append")
+	}
+}
+
+// Query ...
+func (r *Recorder) Query(ctx context.Context, f *Filter) ([]*Entry, error) {
+	return r.store.Query(ctx, f)
+}
+
+// Close ...
+func (r *Recorder) Close() error {
+	return r.store.Close()
+}
+
+// reverse 倒序查找的结果恢复为时间顺序
+func reverse(entries []*Entry) []*Entry {
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"nodeid/pkg/nid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStores(t *testing.T, retention time.Duration) map[string]Store {
+	named, err := nid.NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoError(t, err)
+	bolt, err := NewBoltStore(t.TempDir()+"/audit.db", retention)
+	assert.NoError(t, err)
+	t.Cleanup(func() { bolt.Close() })
+	return map[string]Store{"kv": NewKVStore(named, retention), "bolt": bolt}
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	for name, s := range newStores(t, 0) {
+		t.Run(name, func(t *testing.T) {
+			r := NewRecorder(s)
+			for i := 1; i <= 5; i++ {
+				r.Record(ctx, &Entry{Time: now.Add(time.Duration(i-5) * 24 * time.Hour), Action: nid.EventAllocated, Service: "foo", NodeID: i})
+			}
+			r.Record(ctx, &Entry{Time: now, Action: nid.EventAllocated, Tenant: "shop", Service: "foo", NodeID: 6})
+
+			entries, err := r.Query(ctx, &Filter{Limit: 2})
+			assert.NoError(t, err)
+			if assert.Len(t, entries, 2) {
+				assert.Equal(t, 4, entries[0].NodeID)
+				assert.Equal(t, 5, entries[1].NodeID)
+			}
+
+			entries, err = r.Query(ctx, &Filter{From: now.Add(-36 * time.Hour)})
+			assert.NoError(t, err)
+			assert.Len(t, entries, 2)
+
+			entries, err = r.Query(ctx, &Filter{Tenant: "shop"})
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+
+			entries, err = r.Query(ctx, &Filter{AllTenants: true})
+			assert.NoError(t, err)
+			assert.Len(t, entries, 6)
+		})
+	}
+}
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	for name, s := range newStores(t, 48*time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			r := NewRecorder(s)
+			// 第一次写入时记录最早的日期, 之后的写入清理过期记录
+			r.Record(ctx, &Entry{Time: now.Add(-5 * 24 * time.Hour), Action: nid.EventAllocated, Service: "foo", NodeID: 1})
+			if kv, ok := s.(*kvStore); ok {
+				kv.lastDay = ""
+			}
+			r.Record(ctx, &Entry{Time: now, Action: nid.EventAllocated, Service: "foo", NodeID: 2})
+
+			entries, err := r.Query(ctx, &Filter{})
+			assert.NoError(t, err)
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, 2, entries[0].NodeID)
+			}
+		})
+	}
+}
+
+func TestActor(t *testing.T) {
+	s := newStores(t, 0)["bolt"]
+	r := NewRecorder(s)
+	ctx := WithActor(context.Background(), "ops", "alice")
+
+	r.OnEvent(ctx, &nid.Event{Type: nid.EventReleased, ServiceKey: "nodeId/foo", NodeID: 1, Time: time.Now()})
+
+	entries, err := r.Query(ctx, &Filter{})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, nid.EventReleased, entries[0].Action)
+		assert.Equal(t, "ops", entries[0].Actor)
+		assert.Equal(t, "alice", entries[0].Claimed)
+	}
+}
+
+func TestRecordRecovered(t *testing.T) {
+	ctx := context.Background()
+	r := NewRecorder(newStores(t, 0)["bolt"])
+	named, err := nid.NewBoltNamed(t.TempDir()+"/node.bolt", nid.OnEvent(r.OnEvent))
+	assert.NoError(t, err)
+
+	holder := &nid.NameHolder{ServiceKey: "nodeId/foo", LocalIP: "127.0.0.1", LocalPath: "/app"}
+	id, err := named.GetNodeIDContext(ctx, holder)
+	assert.NoError(t, err)
+	_, err = named.GetNodeIDContext(ctx, holder)
+	assert.NoError(t, err)
+	// 续约不记录
+	assert.NoError(t, named.RenewNodeID(ctx, holder, id))
+
+	entries, err := r.Query(ctx, &Filter{})
+	assert.NoError(t, err)
+	var actions []string
+	for _, e := range entries {
+		assert.Equal(t, id, e.NodeID)
+		actions = append(actions, e.Action)
+	}
+	assert.ElementsMatch(t, []string{nid.EventAllocated, nid.EventRecovered}, actions)
+}
@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"nodeid/pkg/log"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const (
+	bucketName    = "audit"
+	pruneInterval = time.Minute
+)
+
+// NewBoltStore 审计记录保存在本地bolt文件中, 按写入顺序编号.
+// retention大于0时, 写入时每分钟最多清理一次超过保留时间的记录
+func NewBoltStore(path string, retention time.Duration) (Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "open audit file")
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db, retention: retention}, nil
+}
+
+type boltStore struct {
+	db        *bolt.DB
+	retention time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func (s *boltStore) Append(_ context.Context, e *Entry) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.ID = strconv.FormatUint(seq, 10)
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return b.Put(key, data)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.retention > 0 && s.duePrune() {
+		if err := s.prune(time.Now().Add(-s.retention)); err != nil {
+			log.Error().Err(err).Msg("audit delete expired")
+		}
+	}
+	return nil
+}
+
+func (s *boltStore) duePrune() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastPrune) < pruneInterval {
+		return false
+	}
+	s.lastPrune = time.Now()
+	return true
+}
+
+// prune 从最早的记录开始删除, 遇到不早于cutoff的记录即停止
+func (s *boltStore) prune(cutoff time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		var expired [][]byte
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			e := &Entry{}
+			if json.Unmarshal(v, e) == nil && !e.Time.Before(cutoff) {
+				break
+			}
+			expired = append(expired, k)
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Query 从最新的记录倒序查找, 取够Limit条或早于From时停止
+func (s *boltStore) Query(_ context.Context, f *Filter) ([]*Entry, error) {
+	entries := make([]*Entry, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(bucketName)).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			e := &Entry{}
+			if json.Unmarshal(v, e) != nil {
+				continue
+			}
+			if !f.From.IsZero() && e.Time.Before(f.From) {
+				return nil
+			}
+			if !f.match(e) {
+				continue
+			}
+			entries = append(entries, e)
+			if f.Limit > 0 && len(entries) >= f.Limit {
+				return nil
+			}
+		}
+		return nil
+	})
+	return reverse(entries), err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nodeid/pkg/log"
+	"nodeid/pkg/nid"
+
+	"github.com/docker/libkv/store"
+)
+
+// KVRoot kv后端中审计记录的key前缀
+const KVRoot = "audit/"
+
+const (
+	dayLayout = "20060102"
+	oldestKey = KVRoot + "oldest" // 最早一天的日期, 查询和清理从这一天开始
+)
+
+// NewKVStore 审计记录保存在kv后端中, 多个实例共享.
+// key为audit/<UTC日期>/<纳秒时间戳>-<随机数>, 查询时按天倒序列出, 取够Limit条即停止.
+// retention大于0时, 每天第一次写入时删除超过保留时间的整天记录
+func NewKVStore(kv nid.KV, retention time.Duration) Store {
+	return &kvStore{kv: kv, retention: retention}
+}
+
+type kvStore struct {
+	kv        nid.KV
+	retention time.Duration
+
+	mu      sync.Mutex
+	lastDay string // 本进程最近一次写入的日期
+}
+
+func dayOf(t time.Time) string {
+	return t.UTC().Format(dayLayout)
+}
+
+func (s *kvStore) Append(ctx context.Context, e *Entry) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	e.ID = fmt.Sprintf("%020d-%s", e.Time.UnixNano(), hex.EncodeToString(suffix))
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	day := dayOf(e.Time)
+	if err := s.kv.PutKey(ctx, KVRoot+day+"/"+e.ID, data, nil); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	first := day > s.lastDay
+	if first {
+		s.lastDay = day
+	}
+	s.mu.Unlock()
+	if first {
+		s.rollover(ctx, day)
+	}
+	return nil
+}
+
+// rollover 记录最早的日期, 删除超过保留时间的记录. 失败时等到下一天再处理
+func (s *kvStore) rollover(ctx context.Context, day string) {
+	oldest, pair, err := s.oldest(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("audit read oldest day")
+		return
+	}
+	if oldest == "" {
+		if err := s.kv.PutKey(ctx, oldestKey, []byte(day), nil); err != nil {
+			log.Error().Err(err).Msg("audit write oldest day")
+		}
+		return
+	}
+	if s.retention <= 0 {
+		return
+	}
+
+	cutoff := dayOf(time.Now().Add(-s.retention))
+	if oldest >= cutoff {
+		return
+	}
+	// 先更新最早日期, 其他实例不会再查询将要删除的记录
+	if err := s.kv.PutKey(ctx, oldestKey, []byte(cutoff), pair); err != nil {
+		log.Error().Err(err).Msg("audit write oldest day")
+		return
+	}
+	for d, _ := time.Parse(dayLayout, oldest); dayOf(d) < cutoff; d = d.AddDate(0, 0, 1) {
+		if err := s.deleteDay(ctx, dayOf(d)); err != nil {
+			log.Error().Err(err).Str("day", dayOf(d)).Msg("audit delete expired")
+			return
+		}
+	}
+}
+
+func (s *kvStore) deleteDay(ctx context.Context, day string) error {
+	pairs, err := s.kv.ListKeys(ctx, KVRoot+day+"/")
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if err := s.kv.DeleteKey(ctx, strings.TrimPrefix(pair.Key, "/"), nil); err != nil && err != nid.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvStore) oldest(ctx context.Context) (string, *store.KVPair, error) {
+	pair, err := s.kv.GetKey(ctx, oldestKey)
+	if err == nid.ErrNotFound {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return string(pair.Value), pair, nil
+}
+
+func (s *kvStore) Query(ctx context.Context, f *Filter) ([]*Entry, error) {
+	oldest, _, err := s.oldest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	to := time.Now()
+	if !f.To.IsZero() && f.To.Before(to) {
+		to = f.To
+	}
+	first := dayOf(to)
+	if oldest != "" {
+		first = oldest
+	} else if s.retention > 0 {
+		first = dayOf(time.Now().Add(-s.retention))
+	}
+	if !f.From.IsZero() && dayOf(f.From) > first {
+		first = dayOf(f.From)
+	}
+
+	// 从最新的一天开始倒序查找
+	entries := make([]*Entry, 0)
+	for d := to.UTC(); dayOf(d) >= first; d = d.AddDate(0, 0, -1) {
+		pairs, err := s.kv.ListKeys(ctx, KVRoot+dayOf(d)+"/")
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key > pairs[j].Key })
+
+		for _, pair := range pairs {
+			e := &Entry{}
+			if json.Unmarshal(pair.Value, e) != nil || !f.match(e) {
+				continue
+			}
+			entries = append(entries, e)
+			if f.Limit > 0 && len(entries) >= f.Limit {
+				return reverse(entries), nil
+			}
+		}
+	}
+	return reverse(entries), nil
+}
+
+func (s *kvStore) Close() error {
+	return nil
+}
@@ -0,0 +1,342 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxAcquireBackoff = 30 * time.Second
+	// defaultRenew 服务没有设置租约时的续约间隔
+	defaultRenew = 30 * time.Second
+	acceptRetry  = 100 * time.Millisecond
+)
+
+// agent 代替不能调用接口的进程持有编号: 申请后定期续约, 写入文件或通过unix socket提供,
+// 退出时释放. 续约失败超过租约时长后删除文件、不再提供编号, 编号被收回后重新申请
+type agent struct {
+	o      *options
+	client Client
+	req    *store.NodeRequest
+
+	file   string
+	socket string
+	renew  time.Duration // 为0时为租约时长的1/3
+
+	mu        sync.Mutex
+	id        int
+	ttl       time.Duration // 服务的租约时长, 0表示不过期
+	lastRenew time.Time     // 最近一次申请或续约成功的时间
+	expired   bool
+}
+
+func runAgent(o *options, args []string) error {
+	a := &agent{o: o}
+	o.holderFlags()
+	o.fs.StringVar(&a.file, "file", "", "write the id to this file")
+	o.fs.StringVar(&a.socket, "socket", "", "serve the id on this unix socket")
+	o.fs.DurationVar(&a.renew, "renew", 0, "renew interval, must be shorter than the lease ttl, default ttl/3")
+	pos, err := o.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if a.file == "" && a.socket == "" {
+		return errors.New("--file or --socket is required")
+	}
+	if a.renew < 0 || (a.renew == 0 && flagSet(o.fs, "renew")) {
+		return errors.New("--renew must be positive")
+	}
+
+	c, closeFn, err := o.client()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	a.client, a.req = c, o.request(pos[0])
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(stop)
+	return a.run(stop)
+}
+
+// run 持有编号直到收到stop
+func (a *agent) run(stop <-chan os.Signal) error {
+	if !a.acquire(stop) {
+		return nil
+	}
+
+	interval, err := a.interval()
+	if err != nil {
+		a.release()
+		return err
+	}
+	if a.socket != "" {
+		closeFn, err := a.listen()
+		if err != nil {
+			a.release()
+			return err
+		}
+		defer closeFn()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case sig := <-stop:
+			a.logf("received %s, releasing %d", sig, a.current())
+			return a.release()
+		case <-ticker.C:
+			a.tick()
+		}
+	}
+}
+
+// acquire 申请编号并续约一次以获取租约时长, 失败时退避重试, 收到退出信号时返回false
+func (a *agent) acquire(stop <-chan os.Signal) bool {
+	backoff := time.Second
+	for {
+		id, err := a.get()
+		if err == nil {
+			a.set(id)
+			if err = a.renewOnce(); err == nil {
+				return true
+			}
+		}
+		a.logf("acquire failed, retry in %s: %v", backoff, err)
+
+		select {
+		case <-stop:
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxAcquireBackoff {
+			backoff = maxAcquireBackoff
+		}
+	}
+}
+
+// interval 续约间隔需要小于租约时长, 没有指定时为租约时长的1/3
+func (a *agent) interval() (time.Duration, error) {
+	a.mu.Lock()
+	ttl := a.ttl
+	a.mu.Unlock()
+
+	switch {
+	case a.renew > 0 && ttl > 0 && a.renew >= ttl:
+		return 0, errors.Errorf("--renew %s must be shorter than the lease ttl %s of %s", a.renew, ttl, a.req.Service)
+	case a.renew > 0:
+		return a.renew, nil
+	case ttl > 0:
+		return ttl / 3, nil
+	}
+	return defaultRenew, nil
+}
+
+// tick 续约, 编号已被收回时重新申请. 超过租约时长没有续约成功时不再提供编号
+func (a *agent) tick() {
+	err := a.renewOnce()
+	if errors.Is(err, nid.ErrNotFound) {
+		a.logf("node id %d was reclaimed, acquiring a new one", a.current())
+		var id int
+		if id, err = a.get(); err == nil {
+			a.set(id)
+			err = a.renewOnce()
+		}
+	}
+	if err != nil {
+		a.logf("renew failed: %v", err)
+		a.checkExpired()
+	}
+}
+
+func (a *agent) get() (int, error) {
+	ctx, cancel := a.o.context()
+	defer cancel()
+	return a.client.GetNodeID(ctx, a.req)
+}
+
+// renewOnce 续约当前的编号, 成功后记录时间和租约时长, 已经过期时重新写入文件
+func (a *agent) renewOnce() error {
+	ctx, cancel := a.o.context()
+	defer cancel()
+	id := a.current()
+	ttl, err := a.client.RenewNodeID(ctx, a.req, id)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.ttl, a.lastRenew = ttl, time.Now()
+	expired := a.expired
+	a.expired = false
+	a.mu.Unlock()
+
+	if expired {
+		a.logf("renewed %d after the lease expired", id)
+		a.writeFile(id)
+	}
+	return nil
+}
+
+// checkExpired 超过租约时长没有续约成功时, 编号可能已分配给其他进程, 删除文件并停止在socket上提供
+func (a *agent) checkExpired() {
+	a.mu.Lock()
+	expire := a.ttl > 0 && !a.expired && time.Since(a.lastRenew) > a.ttl
+	if expire {
+		a.expired = true
+	}
+	a.mu.Unlock()
+
+	if !expire {
+		return
+	}
+	a.logf("lease of %d expired, stop serving it", a.current())
+	if a.file != "" {
+		if err := os.Remove(a.file); err != nil && !os.IsNotExist(err) {
+			a.logf("remove %s failed: %v", a.file, err)
+		}
+	}
+}
+
+// set 编号变化或租约过期后重新得到编号时更新文件
+func (a *agent) set(id int) {
+	a.mu.Lock()
+	previous, expired := a.id, a.expired
+	a.id, a.lastRenew, a.expired = id, time.Now(), false
+	a.mu.Unlock()
+
+	if id == previous && !expired {
+		return
+	}
+	switch {
+	case previous == 0:
+		a.logf("acquired %d for %s", id, a.req.Service)
+	case id != previous:
+		a.logf("node id changed from %d to %d, the previous id was reclaimed", previous, id)
+	}
+	a.writeFile(id)
+}
+
+func (a *agent) writeFile(id int) {
+	if a.file == "" {
+		return
+	}
+	if err := writeFileAtomic(a.file, []byte(strconv.Itoa(id)+"\n")); err != nil {
+		a.logf("write %s failed: %v", a.file, err)
+	}
+}
+
+func (a *agent) current() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.id
+}
+
+// serving 返回当前可以提供的编号, 租约过期时返回0
+func (a *agent) serving() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.expired {
+		return 0
+	}
+	return a.id
+}
+
+// listen 每个连接写入一行编号后关闭, 租约过期时直接关闭连接. 返回的函数停止监听
+func (a *agent) listen() (func(), error) {
+	if err := os.Remove(a.socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", a.socket)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					a.logf("accept failed, retrying: %v", err)
+					time.Sleep(acceptRetry)
+					continue
+				}
+				select {
+				case <-done:
+				default:
+					a.logf("accept failed, stop serving on %s: %v", a.socket, err)
+				}
+				return
+			}
+			if id := a.serving(); id != 0 {
+				fmt.Fprintf(conn, "%d\n", id)
+			}
+			conn.Close()
+		}
+	}()
+	return func() {
+		close(done)
+		ln.Close()
+	}, nil
+}
+
+// release 先删除文件, 避免进程读到已经释放的编号
+func (a *agent) release() error {
+	if a.file != "" {
+		if err := os.Remove(a.file); err != nil && !os.IsNotExist(err) {
+			a.logf("remove %s failed: %v", a.file, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.o.timeout)
+	defer cancel()
+	id, err := a.client.ReleaseNodeID(ctx, a.req)
+	if err != nil {
+		return errors.Wrap(err, "release")
+	}
+	a.logf("released %d", id)
+	return nil
+}
+
+func (a *agent) logf(format string, args ...interface{}) {
+	fmt.Fprintf(a.o.fs.Output(), "%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// writeFileAtomic 先写临时文件再改名, 读取方不会读到写了一半的内容
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient 只实现agent使用的操作
+type fakeClient struct {
+	Client
+
+	mu        sync.Mutex
+	next      int
+	held      int
+	ttl       time.Duration
+	down      bool // 为true时所有请求失败
+	renewals  int
+	released  int
+	recovered int
+}
+
+func (c *fakeClient) GetNodeID(_ context.Context, _ *store.NodeRequest) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return 0, errors.New("backend unavailable")
+	}
+	if c.held != 0 {
+		c.recovered++
+		return c.held, nil
+	}
+	c.next++
+	c.held = c.next
+	return c.held, nil
+}
+
+func (c *fakeClient) RenewNodeID(_ context.Context, _ *store.NodeRequest, nodeID int) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return 0, errors.New("backend unavailable")
+	}
+	if nodeID != c.held {
+		return 0, errors.Wrap(nid.ErrNotFound, "not held")
+	}
+	c.renewals++
+	return c.ttl, nil
+}
+
+func (c *fakeClient) ReleaseNodeID(_ context.Context, _ *store.NodeRequest) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.held
+	c.held = 0
+	c.released = id
+	return id, nil
+}
+
+func (c *fakeClient) set(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f()
+}
+
+func newTestAgent(t *testing.T, c *fakeClient, renew time.Duration) *agent {
+	o := &options{fs: flag.NewFlagSet("agent", flag.ContinueOnError), timeout: time.Second}
+	o.fs.SetOutput(&bytes.Buffer{})
+	dir := t.TempDir()
+	return &agent{
+		o:      o,
+		client: c,
+		req:    &store.NodeRequest{Service: "foo", Addr: "127.0.0.1", Path: "/app"},
+		file:   dir + "/foo.id",
+		socket: dir + "/foo.sock",
+		renew:  renew,
+	}
+}
+
+func readID(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	assert.NoError(t, err)
+	return strings.TrimSpace(string(data))
+}
+
+func dialID(t *testing.T, socket string) string {
+	conn, err := net.Dial("unix", socket)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer conn.Close()
+	data, _ := ioutil.ReadAll(conn)
+	return strings.TrimSpace(string(data))
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	assert.Eventually(t, cond, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestAgent(t *testing.T) {
+	c := &fakeClient{ttl: 90 * time.Millisecond}
+	a := newTestAgent(t, c, 0)
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- a.run(stop) }()
+
+	// 申请后写入文件并在socket上提供
+	eventually(t, func() bool { return readID(t, a.file) == "1" })
+	assert.Equal(t, "1", dialID(t, a.socket))
+
+	// 续约间隔为租约的1/3, 不通过GetNodeID续约
+	eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.renewals >= 3
+	})
+	c.set(func() { assert.Equal(t, 0, c.recovered) })
+
+	// 编号被收回后重新申请
+	c.set(func() { c.held = 0 })
+	eventually(t, func() bool { return readID(t, a.file) == "2" })
+	assert.Equal(t, "2", dialID(t, a.socket))
+
+	stop <- os.Interrupt
+	assert.NoError(t, <-done)
+	assert.Equal(t, "", readID(t, a.file))
+	c.set(func() { assert.Equal(t, 2, c.released) })
+}
+
+func TestAgentLeaseExpired(t *testing.T) {
+	c := &fakeClient{ttl: 60 * time.Millisecond}
+	a := newTestAgent(t, c, 0)
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- a.run(stop) }()
+	eventually(t, func() bool { return readID(t, a.file) == "1" })
+
+	// 续约失败超过租约时长后删除文件, socket不再返回编号
+	c.set(func() { c.down = true })
+	eventually(t, func() bool { return readID(t, a.file) == "" })
+	assert.Equal(t, "", dialID(t, a.socket))
+
+	// 恢复后续约成功, 重新提供原来的编号
+	c.set(func() { c.down = false })
+	eventually(t, func() bool { return readID(t, a.file) == "1" })
+	assert.Equal(t, "1", dialID(t, a.socket))
+
+	stop <- os.Interrupt
+	assert.NoError(t, <-done)
+}
+
+func TestAgentRenewInterval(t *testing.T) {
+	c := &fakeClient{ttl: time.Minute}
+	a := newTestAgent(t, c, time.Minute)
+	stop := make(chan os.Signal, 1)
+	err := a.run(stop)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must be shorter than the lease ttl")
+	// 申请到的编号已释放
+	c.set(func() { assert.Equal(t, 1, c.released) })
+
+	for _, tc := range []struct {
+		renew, ttl, want time.Duration
+	}{
+		{0, 90 * time.Second, 30 * time.Second},
+		{0, 0, defaultRenew},
+		{10 * time.Second, time.Minute, 10 * time.Second},
+		{time.Hour, 0, time.Hour},
+	} {
+		a := newTestAgent(t, c, tc.renew)
+		a.ttl = tc.ttl
+		got, err := a.interval()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, got)
+	}
+}
@@ -0,0 +1,255 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+)
+
+const boltUsage = "bolt buckets|dump|compact|set|delete <file> ..."
+
+var boltCommands = map[string]func(o *options, file string, args []string) error{
+	"buckets": runBoltBuckets,
+	"dump":    runBoltDump,
+	"compact": runBoltCompact,
+	"set":     runBoltSet,
+	"delete":  runBoltDelete,
+}
+
+// runBolt 离线查看和修改bolt文件, 修改前默认备份到<file>.<时间>.bak
+func runBolt(o *options, args []string) error {
+	if len(args) < 2 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(o.fs.Output(), `usage:
+  nodeid bolt buckets <file>
+  nodeid bolt dump <file> [--bucket name] [--prefix prefix]
+  nodeid bolt compact <file> [--out file] [--no-backup]
+  nodeid bolt set <file> <key> [--ip ip] [--path path] [--value json] [--no-backup]
+  nodeid bolt delete <file> <key> [--no-backup]`)
+		return flag.ErrHelp
+	}
+	run, ok := boltCommands[args[0]]
+	if !ok {
+		return errors.Errorf("unknown bolt command %q", args[0])
+	}
+	return run(o, args[1], args[2:])
+}
+
+func runBoltBuckets(o *options, file string, args []string) error {
+	if _, err := o.parse(args, 0, 0); err != nil {
+		return err
+	}
+	f, err := nid.OpenBoltFile(file, true, o.timeout)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buckets, err := f.Buckets()
+	if err != nil {
+		return err
+	}
+	names := sortedNames(buckets)
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		rows = append(rows, []string{name, strconv.Itoa(buckets[name])})
+	}
+	return o.print(buckets, []string{"BUCKET", "KEYS"}, rows)
+}
+
+func runBoltDump(o *options, file string, args []string) error {
+	var bucket, prefix string
+	o.fs.StringVar(&bucket, "bucket", "", "only dump this bucket")
+	o.fs.StringVar(&prefix, "prefix", "", "only dump keys with this prefix")
+	if _, err := o.parse(args, 0, 0); err != nil {
+		return err
+	}
+	f, err := nid.OpenBoltFile(file, true, o.timeout)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	records, err := f.Dump(bucket, prefix)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, recordRow(r))
+	}
+	return o.print(records, []string{"BUCKET", "KEY", "INDEX", "IP", "PATH", "APPLY TIME / VALUE"}, rows)
+}
+
+// runBoltCompact 不指定--out时替换原文件, 原文件保留为备份
+func runBoltCompact(o *options, file string, args []string) error {
+	var out string
+	var noBackup bool
+	o.fs.StringVar(&out, "out", "", "write the compacted file here instead of replacing the original")
+	o.fs.BoolVar(&noBackup, "no-backup", false, "do not keep the original file when replacing it")
+	if _, err := o.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	before := fileSize(file)
+	dst := out
+	if out == "" {
+		dst = file
+		backup := ""
+		if !noBackup {
+			backup = backupName(file)
+		}
+		if err := nid.CompactBoltFileInPlace(file, backup, o.timeout); err != nil {
+			return err
+		}
+		if backup != "" {
+			fmt.Fprintf(o.fs.Output(), "backup written to %s\n", backup)
+		}
+	} else if err := nid.CompactBoltFile(file, out, o.timeout); err != nil {
+		return err
+	}
+	after := fileSize(dst)
+
+	return o.print(map[string]interface{}{"file": dst, "before": before, "after": after},
+		[]string{"FILE", "BEFORE", "AFTER"},
+		[][]string{{dst, strconv.FormatInt(before, 10), strconv.FormatInt(after, 10)}})
+}
+
+// runBoltSet 修改编号记录的持有者, 或者用--value写入任意内容
+func runBoltSet(o *options, file string, args []string) error {
+	var value string
+	var noBackup bool
+	o.holderFlags()
+	o.fs.StringVar(&value, "value", "", "raw json value, overrides --ip and --path")
+	o.fs.BoolVar(&noBackup, "no-backup", false, "do not back up the file before writing")
+	pos, err := o.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if value == "" && !flagSet(o.fs, "ip") {
+		return errors.New("--ip or --value is required")
+	}
+	if err := nid.CheckBoltValue(pos[0], []byte(value)); value != "" && err != nil {
+		return err
+	}
+
+	f, err := nid.OpenBoltFile(file, false, o.timeout)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := o.backup(f, file, noBackup); err != nil {
+		return err
+	}
+
+	var previous *nid.BoltRecord
+	if value != "" {
+		previous, err = f.Put(pos[0], []byte(value))
+	} else {
+		previous, err = f.PutHolder(pos[0], &nid.NameHolder{LocalIP: o.ip, LocalPath: o.path})
+	}
+	if err != nil {
+		return err
+	}
+	current, err := f.Get(pos[0])
+	if err != nil {
+		return err
+	}
+	return o.printChange(previous, current)
+}
+
+func runBoltDelete(o *options, file string, args []string) error {
+	var noBackup bool
+	o.fs.BoolVar(&noBackup, "no-backup", false, "do not back up the file before deleting")
+	pos, err := o.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	f, err := nid.OpenBoltFile(file, false, o.timeout)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Get(pos[0]); err == nid.ErrNotFound {
+		return errors.Errorf("key %s not found", pos[0])
+	}
+	if err := o.backup(f, file, noBackup); err != nil {
+		return err
+	}
+	previous, err := f.Delete(pos[0])
+	if err != nil {
+		return err
+	}
+	return o.printChange(previous, nil)
+}
+
+// backup 修改前备份整个文件, 文件打开期间其他进程无法写入
+func (o *options) backup(f *nid.BoltFile, file string, noBackup bool) error {
+	if noBackup {
+		return nil
+	}
+	backup := backupName(file)
+	if err := f.Backup(backup); err != nil {
+		return errors.Wrap(err, "backup")
+	}
+	fmt.Fprintf(o.fs.Output(), "backup written to %s\n", backup)
+	return nil
+}
+
+func (o *options) printChange(previous, current *nid.BoltRecord) error {
+	rows := make([][]string, 0, 2)
+	if previous != nil {
+		rows = append(rows, append([]string{"before"}, recordRow(previous)[1:]...))
+	}
+	if current != nil {
+		rows = append(rows, append([]string{"after"}, recordRow(current)[1:]...))
+	}
+	return o.print(map[string]*nid.BoltRecord{"previous": previous, "current": current},
+		[]string{"", "KEY", "INDEX", "IP", "PATH", "APPLY TIME / VALUE"}, rows)
+}
+
+func recordRow(r *nid.BoltRecord) []string {
+	row := []string{r.Bucket, r.Key, "", "", "", string(r.Value)}
+	if r.Index > 0 {
+		row[2] = strconv.FormatUint(r.Index, 10)
+	}
+	if r.Holder != nil {
+		row[3], row[4], row[5] = r.Holder.LocalIP, r.Holder.LocalPath, r.Holder.ApplyTime
+	}
+	return row
+}
+
+func flagSet(fs *flag.FlagSet, name string) (set bool) {
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return
+}
+
+// backupName 同一秒内多次备份时加上序号, 不覆盖已有的备份
+func backupName(file string) string {
+	name := file + "." + time.Now().Format("20060102150405")
+	backup := name + ".bak"
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			return backup
+		}
+		backup = fmt.Sprintf("%s.%d.bak", name, i)
+	}
+}
+
+func fileSize(file string) int64 {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"nodeid/internal/store"
+
+	"github.com/pkg/errors"
+)
+
+// 默认的服务地址和鉴权token
+const (
+	EnvServer = "NODEID_SERVER"
+	EnvToken  = "NODEID_TOKEN"
+)
+
+const defaultServer = "http://127.0.0.1:8086"
+
+type command struct {
+	usage string
+	run   func(o *options, args []string) error
+}
+
+var commands = map[string]command{
+	"get":     {"get <service> [--ip ip] [--path path] [--idempotency-key key]", runGet},
+	"release": {"release <service> [--ip ip] [--path path]", runRelease},
+	"list":    {"list [service]", runList},
+	"evict":   {"evict <service> <id>", runEvict},
+	"reserve": {"reserve <service> <id> [--ip ip] [--path path]", runReserve},
+	"export":  {"export [--file file] [--format json|ndjson]", runExport},
+	"import":  {"import [--file file] [--conflict skip|overwrite|fail]", runImport},
+	"bolt":    {boltUsage, runBolt},
+	"agent":   {"agent <service> [--file file] [--socket path] [--ip ip] [--path path] [--renew 30s]", runAgent},
+	"migrate": {"migrate --from backend:addr --to backend:addr [--dry-run] [--follow duration]", runMigrate},
+}
+
+// IsCommand ...
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Usage 列出所有命令
+func Usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  nodeid %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(w, "common flags: --server url [--token token] | --backend consul|etcd|bolt --addr addr, --tenant, --output table|json, --timeout")
+}
+
+// Run 执行命令, 返回进程的退出码
+func Run(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		return 2
+	}
+
+	o := newOptions(name, cmd.usage)
+	if err := cmd.run(o, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	return 0
+}
+
+// options 所有命令共用的参数
+type options struct {
+	fs      *flag.FlagSet
+	server  string
+	token   string
+	backend string
+	addr    string
+	tenant  string
+	output  string
+	timeout time.Duration
+
+	ip, path string
+	out      io.Writer
+}
+
+func newOptions(name, usage string) *options {
+	o := &options{fs: flag.NewFlagSet(name, flag.ContinueOnError), out: os.Stdout}
+	server := os.Getenv(EnvServer)
+	if server == "" {
+		server = defaultServer
+	}
+	o.fs.StringVar(&o.server, "server", server, "nodeid server url, env "+EnvServer)
+	o.fs.StringVar(&o.token, "token", os.Getenv(EnvToken), "bearer token, env "+EnvToken)
+	o.fs.StringVar(&o.backend, "backend", "", "operate on backend directly: consul, etcd or bolt")
+	o.fs.StringVar(&o.addr, "addr", "", "backend address or bolt file")
+	o.fs.StringVar(&o.tenant, "tenant", "", "tenant, default tenant if empty")
+	o.fs.StringVar(&o.output, "output", "table", "output format: table or json")
+	o.fs.DurationVar(&o.timeout, "timeout", 10*time.Second, "timeout of the whole command")
+	o.fs.Usage = func() {
+		fmt.Fprintf(o.fs.Output(), "usage: nodeid %s\n", usage)
+		o.fs.PrintDefaults()
+	}
+	return o
+}
+
+// holderFlags get、release、reserve使用的持有者参数, ip默认为本机内网ip
+func (o *options) holderFlags() {
+	o.fs.StringVar(&o.ip, "ip", "", "holder ip, default local intranet ip")
+	o.fs.StringVar(&o.path, "path", "", "holder path")
+}
+
+// parse 解析参数, 参数和位置参数可以交替出现, 返回位置参数
+func (o *options) parse(args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := o.fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = o.fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) < min || len(positional) > max {
+		o.fs.Usage()
+		return nil, flag.ErrHelp
+	}
+	if o.output != "table" && o.output != "json" {
+		return nil, errors.Errorf("unknown output format %q", o.output)
+	}
+	if o.ip == "" {
+		o.ip = localIP()
+	}
+	return positional, nil
+}
+
+// client 指定了backend时直接访问存储后端, 否则访问服务
+func (o *options) client() (Client, func(), error) {
+	if o.backend == "" {
+		return newHTTPClient(o.server, o.token), func() {}, nil
+	}
+	c, err := newDirectClient(o.backend, o.addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, c.Close, nil
+}
+
+func (o *options) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), o.timeout)
+}
+
+func (o *options) request(service string) *store.NodeRequest {
+	return &store.NodeRequest{
+		Tenant:  o.tenant,
+		Service: service,
+		Path:    o.path,
+		Addr:    o.ip,
+	}
+}
+
+func parseID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return 0, errors.Errorf("invalid node id %q", s)
+	}
+	return id, nil
+}
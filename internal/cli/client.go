@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"nodeid/internal/service"
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+)
+
+// Client 命令行使用的操作, 可以通过http访问服务, 也可以直接访问存储后端
+type Client interface {
+	GetNodeID(ctx context.Context, req *store.NodeRequest) (int, error)
+	ReleaseNodeID(ctx context.Context, req *store.NodeRequest) (int, error)
+	// RenewNodeID 返回服务的租约时长, 编号已被释放或收回时返回nid.ErrNotFound
+	RenewNodeID(ctx context.Context, req *store.NodeRequest, nodeID int) (time.Duration, error)
+	ReserveNodeID(ctx context.Context, req *store.NodeRequest, nodeID int) error
+	EvictNodeID(ctx context.Context, tenant, service string, nodeID int) (*nid.NameHolder, error)
+	Nodes(ctx context.Context, tenant, service string) ([]*nid.Node, error)
+	Services(ctx context.Context, tenant string) (map[string]int, error)
+	Export(ctx context.Context, tenant string) (*nid.Snapshot, error)
+	Import(ctx context.Context, tenant string, snap *nid.Snapshot, policy string) (*nid.ImportResult, error)
+}
+
+// directClient 直接读写存储后端, 不经过配额检查
+type directClient struct {
+	service.UseCase
+	named nid.NodeNamed
+}
+
+func newDirectClient(backend, addr string) (*directClient, error) {
+	named, err := nid.Open(backend, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &directClient{
+		UseCase: service.NewUseCase(store.NewDao(named)),
+		named:   named,
+	}, nil
+}
+
+func (c *directClient) Close() {
+	c.named.Close()
+}
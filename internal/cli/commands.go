@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+)
+
+func runGet(o *options, args []string) error {
+	o.holderFlags()
+	var key string
+	o.fs.StringVar(&key, "idempotency-key", "", "return the same id for retries with the same key")
+	pos, err := o.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, closeFn, err := o.client()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	ctx, cancel := o.context()
+	defer cancel()
+
+	req := o.request(pos[0])
+	req.IdempotencyKey = key
+	id, err := c.GetNodeID(ctx, req)
+	if err != nil {
+		return err
+	}
+	return o.print(map[string]int{"nodeId": id}, []string{"NODE ID"}, [][]string{{strconv.Itoa(id)}})
+}
+
+func runRelease(o *options, args []string) error {
+	o.holderFlags()
+	pos, err := o.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, closeFn, err := o.client()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	ctx, cancel := o.context()
+	defer cancel()
+
+	id, err := c.ReleaseNodeID(ctx, o.request(pos[0]))
+	if err != nil {
+		return err
+	}
+	return o.print(map[string]int{"nodeId": id}, []string{"RELEASED"}, [][]string{{strconv.Itoa(id)}})
+}
+
+func runReserve(o *options, args []string) error {
+	o.holderFlags()
+	pos, err := o.parse(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(pos[1])
+	if err != nil {
+		return err
+	}
+
+	c, closeFn, err := o.client()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	ctx, cancel := o.context()
+	defer cancel()
+
+	if err := c.ReserveNodeID(ctx, o.request(pos[0]), id); err != nil {
+		return err
+	}
+	return o.print(map[string]int{"nodeId": id}, []string{"RESERVED"}, [][]string{{strconv.Itoa(id)}})
+}
+
+func runEvict(o *options, args []string) error {
+	pos, err := o.parse(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(pos[1])
+	if err != nil {
+		return err
+	}
+
+	c, closeFn, err := o.client()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	ctx, cancel := o.context()
+	defer cancel()
+
+	previous, err := c.EvictNodeID(ctx, o.tenant, pos[0], id)
+	if err != nil {
+		return err
+	}
+
+	row := []string{strconv.Itoa(id), "", ""}
+	if previous != nil {
+		row[1], row[2] = previous.LocalIP, previous.LocalPath
+	}
+	return o.print(map[string]interface{}{"nodeId": id, "previous": previous},
+		[]string{"EVICTED", "IP", "PATH"}, [][]string{row})
+}
+
+// runList 不指定服务时列出所有服务及占用的编号数
+func runList(o *options, args []string) error {
+	pos, err := o.parse(args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	c, closeFn, err := o.client()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	ctx, cancel := o.context()
+	defer cancel()
+
+	if len(pos) == 0 {
+		services, err := c.Services(ctx, o.tenant)
+		if err != nil {
+			return err
+		}
+		names := sortedNames(services)
+		rows := make([][]string, 0, len(names))
+		for _, name := range names {
+			rows = append(rows, []string{name, strconv.Itoa(services[name])})
+		}
+		return o.print(services, []string{"SERVICE", "HELD"}, rows)
+	}
+
+	nodes, err := c.Nodes(ctx, o.tenant, pos[0])
+	if err != nil {
+		return err
+	}
+	return o.print(nodes, []string{"ID", "IP", "PATH", "APPLY TIME"}, nodeRows(nodes))
+}
+
+func nodeRows(nodes []*nid.Node) [][]string {
+	rows := make([][]string, 0, len(nodes))
+	for _, n := range nodes {
+		rows = append(rows, []string{strconv.Itoa(n.NodeID), n.LocalIP, n.LocalPath, n.ApplyTime})
+	}
+	return rows
+}
+
+func sortedNames(services map[string]int) []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runExport 导出租户下所有的编号记录, 包括原始内容和版本号
+func runExport(o *options, args []string) error {
+	var file, format string
+	o.fs.StringVar(&file, "file", "", "write to file instead of stdout")
+	o.fs.StringVar(&format, "format", "json", "snapshot format: json or ndjson")
+	if _, err := o.parse(args, 0, 0); err != nil {
+		return err
+	}
+	if format != "json" && format != "ndjson" {
+		return errors.Errorf("unknown format %q", format)
+	}
+
+	c, closeFn, err := o.client()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	ctx, cancel := o.context()
+	defer cancel()
+
+	snap, err := c.Export(ctx, o.tenant)
+	if err != nil {
+		return err
+	}
+
+	if file == "" {
+		return nid.WriteSnapshot(o.out, snap, format == "ndjson")
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := nid.WriteSnapshot(f, snap, format == "ndjson"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runImport 按快照写入记录, 记录已存在时按--conflict处理
+func runImport(o *options, args []string) error {
+	var file, policy string
+	o.fs.StringVar(&file, "file", "", "read from file instead of stdin")
+	o.fs.StringVar(&policy, "conflict", nid.ConflictSkip, "when a record exists: skip, overwrite or fail")
+	if _, err := o.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	snap, err := nid.ReadSnapshot(in)
+	if err != nil {
+		return err
+	}
+
+	c, closeFn, err := o.client()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	ctx, cancel := o.context()
+	defer cancel()
+
+	result, err := c.Import(ctx, o.tenant, snap, policy)
+	if err != nil {
+		return err
+	}
+	return o.print(result, []string{"CREATED", "OVERWRITTEN", "SKIPPED", "CONFLICTS"}, [][]string{{
+		strconv.Itoa(result.Created),
+		strconv.Itoa(result.Overwritten),
+		strconv.Itoa(result.Skipped),
+		strings.Join(result.Conflicts, ","),
+	}})
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"nodeid/internal/controller"
+	httpCtrl "nodeid/internal/controller/http"
+	"nodeid/internal/service"
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// runCommand 执行命令并返回输出
+func runCommand(t *testing.T, name string, args ...string) (string, error) {
+	cmd, ok := commands[name]
+	if !assert.True(t, ok, name) {
+		return "", nil
+	}
+	o := newOptions(name, cmd.usage)
+	out := &bytes.Buffer{}
+	o.out = out
+	o.fs.SetOutput(&bytes.Buffer{})
+	err := cmd.run(o, args)
+	return out.String(), err
+}
+
+func nodeIDOf(t *testing.T, out string) int {
+	var v struct {
+		NodeID int `json:"nodeId"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(out), &v), out)
+	return v.NodeID
+}
+
+func TestCommandsDirect(t *testing.T) {
+	dir := t.TempDir()
+	backend := []string{"--backend", "bolt", "--addr", dir + "/node.bolt"}
+	cmd := func(name string, args ...string) (string, error) {
+		return runCommand(t, name, append(args, backend...)...)
+	}
+
+	out, err := cmd("get", "foo", "--ip", "10.0.0.1", "--path", "/app", "--output", "json")
+	assert.NoError(t, err)
+	id := nodeIDOf(t, out)
+	assert.NotZero(t, id)
+	// 参数可以出现在位置参数前面
+	out, err = cmd("get", "--ip", "10.0.0.1", "--path", "/app", "foo", "--output", "json")
+	assert.NoError(t, err)
+	assert.Equal(t, id, nodeIDOf(t, out))
+
+	_, err = cmd("reserve", "foo", "5", "--ip", "10.0.0.2")
+	assert.NoError(t, err)
+	out, err = cmd("list")
+	assert.NoError(t, err)
+	assert.Regexp(t, `(?m)^SERVICE\s+HELD\n^foo\s+2$`, strings.TrimSpace(out))
+
+	out, err = cmd("list", "foo", "--output", "json")
+	assert.NoError(t, err)
+	var nodes []*nid.Node
+	assert.NoError(t, json.Unmarshal([]byte(out), &nodes))
+	assert.Len(t, nodes, 2)
+
+	out, err = cmd("evict", "foo", "5")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "10.0.0.2")
+
+	// 导出后导入到另一个后端
+	_, err = cmd("export", "--file", dir+"/snap.json")
+	assert.NoError(t, err)
+	out, err = runCommand(t, "import", "--file", dir+"/snap.json", "--output", "json",
+		"--backend", "bolt", "--addr", dir+"/other.bolt")
+	assert.NoError(t, err)
+	var result nid.ImportResult
+	assert.NoError(t, json.Unmarshal([]byte(out), &result))
+	assert.Equal(t, 1, result.Created)
+
+	out, err = cmd("release", "foo", "--ip", "10.0.0.1", "--path", "/app")
+	assert.NoError(t, err)
+	assert.Regexp(t, `RELEASED\s+`+strconv.Itoa(id), out)
+}
+
+func TestCommandArgs(t *testing.T) {
+	_, err := runCommand(t, "evict", "foo")
+	assert.True(t, errors.Is(err, flag.ErrHelp))
+	_, err = runCommand(t, "evict", "foo", "0", "--backend", "bolt", "--addr", t.TempDir()+"/node.bolt")
+	assert.EqualError(t, err, `invalid node id "0"`)
+	_, err = runCommand(t, "list", "--output", "yaml")
+	assert.EqualError(t, err, `unknown output format "yaml"`)
+	_, err = runCommand(t, "get", "foo", "--backend", "zookeeper")
+	assert.Error(t, err)
+}
+
+func TestCommandsHTTP(t *testing.T) {
+	named, err := nid.NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoError(t, err)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(httpCtrl.NewAuthenticator(map[string]*httpCtrl.Identity{"t": {Name: "ops", Admin: true}}).Middleware())
+	controller.RegisterHandler(r, httpCtrl.NewHttpController(service.NewUseCase(store.NewDao(named)), 0), false)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	server := []string{"--server", srv.URL, "--token", "t", "--tenant", "shop"}
+	out, err := runCommand(t, "get", append([]string{"foo", "--ip", "10.0.0.1", "--output", "json"}, server...)...)
+	assert.NoError(t, err)
+	id := nodeIDOf(t, out)
+
+	out, err = runCommand(t, "list", append([]string{"--output", "json"}, server...)...)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"foo":1}`, out)
+
+	// 服务返回的错误码
+	_, err = runCommand(t, "list", "--server", srv.URL)
+	var apiErr *APIError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, httpCtrl.CodeAccessToken, apiErr.Code)
+	}
+
+	// 续约不存在的编号返回nid.ErrNotFound
+	c := newHTTPClient(srv.URL, "t")
+	req := &store.NodeRequest{Tenant: "shop", Service: "foo", Addr: "10.0.0.1"}
+	_, err = c.RenewNodeID(context.Background(), req, id)
+	assert.NoError(t, err)
+	_, err = c.RenewNodeID(context.Background(), req, id+1)
+	assert.True(t, errors.Is(err, nid.ErrNotFound))
+}
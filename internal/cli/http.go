@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	httpCtrl "nodeid/internal/controller/http"
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+)
+
+const tenantHeader = "X-Tenant"
+
+// APIError 服务返回的错误码
+type APIError struct {
+	Code int
+	Desc string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (errCode %d)", e.Desc, e.Code)
+}
+
+// httpClient 通过v1接口访问运行中的服务
+type httpClient struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+func newHTTPClient(server, token string) *httpClient {
+	return &httpClient{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		client: &http.Client{},
+	}
+}
+
+func (c *httpClient) GetNodeID(ctx context.Context, req *store.NodeRequest) (int, error) {
+	var data struct {
+		NodeID int `json:"nodeId"`
+	}
+	err := c.do(ctx, http.MethodPost, "/named/v1/"+url.PathEscape(req.Service)+"/nodeid", req.Tenant, nil, &nodeBody{
+		IP:             req.Addr,
+		Path:           req.Path,
+		IdempotencyKey: req.IdempotencyKey,
+	}, &data)
+	return data.NodeID, err
+}
+
+func (c *httpClient) ReleaseNodeID(ctx context.Context, req *store.NodeRequest) (int, error) {
+	var data struct {
+		NodeID int `json:"nodeId"`
+	}
+	query := url.Values{"ip": {req.Addr}, "path": {req.Path}}
+	err := c.do(ctx, http.MethodDelete, "/named/v1/"+url.PathEscape(req.Service)+"/nodeid", req.Tenant, query, nil, &data)
+	return data.NodeID, err
+}
+
+func (c *httpClient) RenewNodeID(ctx context.Context, req *store.NodeRequest, nodeID int) (time.Duration, error) {
+	var data struct {
+		LeaseTTL int `json:"leaseTtl"`
+	}
+	path := "/named/v1/" + url.PathEscape(req.Service) + "/nodes/" + strconv.Itoa(nodeID)
+	err := c.do(ctx, http.MethodPut, path, req.Tenant, nil, &nodeBody{IP: req.Addr, Path: req.Path}, &data)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Code == httpCtrl.CodeNotFound {
+		return 0, errors.Wrap(nid.ErrNotFound, apiErr.Desc)
+	}
+	return time.Duration(data.LeaseTTL) * time.Second, err
+}
+
+func (c *httpClient) ReserveNodeID(ctx context.Context, req *store.NodeRequest, nodeID int) error {
+	return c.do(ctx, http.MethodPut, nodePath(req.Service, nodeID), req.Tenant, nil, &nodeBody{
+		IP:   req.Addr,
+		Path: req.Path,
+	}, nil)
+}
+
+func (c *httpClient) EvictNodeID(ctx context.Context, tenant, service string, nodeID int) (*nid.NameHolder, error) {
+	var data struct {
+		Previous *nid.NameHolder `json:"previous"`
+	}
+	err := c.do(ctx, http.MethodDelete, nodePath(service, nodeID), tenant, nil, nil, &data)
+	return data.Previous, err
+}
+
+func (c *httpClient) Nodes(ctx context.Context, tenant, service string) ([]*nid.Node, error) {
+	var data struct {
+		Nodes []*nid.Node `json:"nodes"`
+	}
+	err := c.do(ctx, http.MethodGet, "/named/v1/"+url.PathEscape(service)+"/nodes", tenant, nil, nil, &data)
+	return data.Nodes, err
+}
+
+func (c *httpClient) Services(ctx context.Context, tenant string) (map[string]int, error) {
+	var data struct {
+		Services map[string]int `json:"services"`
+	}
+	err := c.do(ctx, http.MethodGet, "/admin/v1/nodes", tenant, nil, nil, &data)
+	return data.Services, err
+}
+
+// Export 使用ndjson格式, 避免服务端为整个快照缩进
+func (c *httpClient) Export(ctx context.Context, tenant string) (*nid.Snapshot, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/admin/v1/snapshot", tenant, url.Values{"format": {"ndjson"}}, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-ndjson") {
+		return nil, decodeResult(resp, "GET /admin/v1/snapshot", nil)
+	}
+	return nid.ReadSnapshot(resp.Body)
+}
+
+func (c *httpClient) Import(ctx context.Context, tenant string, snap *nid.Snapshot, policy string) (*nid.ImportResult, error) {
+	var buf bytes.Buffer
+	if err := nid.WriteSnapshot(&buf, snap, true); err != nil {
+		return nil, err
+	}
+	resp, err := c.send(ctx, http.MethodPost, "/admin/v1/snapshot", tenant, url.Values{"conflict": {policy}}, "application/x-ndjson", &buf)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &nid.ImportResult{}
+	return result, decodeResult(resp, "POST /admin/v1/snapshot", result)
+}
+
+type nodeBody struct {
+	IP             string `json:"ip"`
+	Path           string `json:"path"`
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+func nodePath(service string, nodeID int) string {
+	return "/admin/v1/services/" + url.PathEscape(service) + "/nodes/" + strconv.Itoa(nodeID)
+}
+
+// do 发送json请求并解析{errCode, errDesc, data}格式的响应, errCode不为0时返回APIError
+func (c *httpClient) do(ctx context.Context, method, path, tenant string, query url.Values, body, data interface{}) error {
+	var r io.Reader
+	contentType := ""
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r, contentType = bytes.NewReader(bs), "application/json"
+	}
+
+	resp, err := c.send(ctx, method, path, tenant, query, contentType, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResult(resp, method+" "+path, data)
+}
+
+func (c *httpClient) send(ctx context.Context, method, path, tenant string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := c.server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if tenant != "" {
+		req.Header.Set(tenantHeader, tenant)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.client.Do(req)
+}
+
+func decodeResult(resp *http.Response, op string, data interface{}) error {
+	var result struct {
+		ErrCode int             `json:"errCode"`
+		ErrDesc string          `json:"errDesc"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return errors.Wrapf(err, "%s: %s", op, resp.Status)
+	}
+	if result.ErrCode != 0 {
+		return &APIError{Code: result.ErrCode, Desc: result.ErrDesc}
+	}
+	if data == nil || len(result.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(result.Data, data)
+}
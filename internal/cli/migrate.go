@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"nodeid/internal/audit"
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+)
+
+// runMigrate 把源后端的所有数据复制到目标后端, 然后检查两边是否一致.
+// --follow期间按--interval重复复制, 用于服务切换到目标后端之前保持同步
+func runMigrate(o *options, args []string) error {
+	var from, to string
+	var dryRun bool
+	var follow, interval time.Duration
+	o.fs.StringVar(&from, "from", "", "source backend, backend:addr, e.g. consul:127.0.0.1:8500")
+	o.fs.StringVar(&to, "to", "", "destination backend, e.g. bolt:/data/node.bolt")
+	o.fs.BoolVar(&dryRun, "dry-run", false, "only report differences, do not write")
+	o.fs.DurationVar(&follow, "follow", 0, "keep copying changes for this long after the first copy")
+	o.fs.DurationVar(&interval, "interval", 5*time.Second, "copy interval when --follow is set")
+	if _, err := o.parse(args, 0, 0); err != nil {
+		return err
+	}
+	if follow > 0 && interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+
+	src, err := openSpec(from)
+	if err != nil {
+		return errors.Wrap(err, "--from")
+	}
+	defer src.Close()
+	dst, err := openSpec(to)
+	if err != nil {
+		return errors.Wrap(err, "--to")
+	}
+	defer dst.Close()
+
+	prefixes := append(store.Prefixes(), audit.KVRoot)
+	ctx, cancel := o.context()
+	defer cancel()
+
+	result, err := nid.Migrate(ctx, src, dst, prefixes, dryRun)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return o.print(result, []string{"KIND", "KEY"}, diffRows(result.Differences))
+	}
+	fmt.Fprintf(o.fs.Output(), "created %d, updated %d, deleted %d\n", result.Created, result.Updated, result.Deleted)
+
+	if follow > 0 {
+		followMigrate(src, dst, prefixes, follow, interval, o)
+		ctx, cancel = o.context()
+		defer cancel()
+	}
+
+	diffs, err := nid.Compare(ctx, src, dst, prefixes)
+	if err != nil {
+		return errors.Wrap(err, "verify")
+	}
+	if len(diffs) == 0 && o.output == "table" {
+		fmt.Fprintln(o.out, "source and destination are identical")
+		return nil
+	}
+	if err := o.print(diffs, []string{"KIND", "KEY"}, diffRows(diffs)); err != nil {
+		return err
+	}
+	if len(diffs) > 0 {
+		return errors.Errorf("%d differences remain after migration", len(diffs))
+	}
+	return nil
+}
+
+// followMigrate 每次复制使用单独的超时, 失败时报告后继续
+func followMigrate(src, dst nid.KV, prefixes []string, follow, interval time.Duration, o *options) {
+	deadline := time.Now().Add(follow)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		ctx, cancel := o.context()
+		result, err := nid.Migrate(ctx, src, dst, prefixes, false)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(o.fs.Output(), "copy failed: %v\n", err)
+			continue
+		}
+		if n := len(result.Differences); n > 0 {
+			fmt.Fprintf(o.fs.Output(), "%s copied %d changes\n", time.Now().Format(time.RFC3339), n)
+		}
+	}
+}
+
+// openSpec 按backend:addr连接存储后端
+func openSpec(spec string) (nid.NodeNamed, error) {
+	ss := strings.SplitN(spec, ":", 2)
+	if len(ss) != 2 || ss[1] == "" {
+		return nil, errors.Errorf("invalid backend %q, must be backend:addr", spec)
+	}
+	return nid.Open(ss[0], ss[1])
+}
+
+func diffRows(diffs []*nid.Difference) [][]string {
+	rows := make([][]string, 0, len(diffs))
+	for _, d := range diffs {
+		rows = append(rows, []string{d.Kind, d.Key})
+	}
+	return rows
+}
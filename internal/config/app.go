@@ -1,5 +1,11 @@
 package config
 
+import (
+	"os"
+
+	"nodeid/pkg/log"
+)
+
 const serverConfFile = "config/app.json"
 
 // AppConf ...
@@ -21,6 +27,98 @@ type AppConf interface {
 
 	// consul地址
 	GetConsulAddr() string
+
+	// trace导出方式: 空(不导出)、stdout、otlp
+	GetTraceExporter() string
+
+	// otlp collector地址, 为空时使用默认地址
+	GetTraceEndpoint() string
+
+	// 单个请求的超时时间(毫秒), 0表示不限制
+	GetRequestTimeout() int
+
+	// 退出时等待请求处理完成的时间(毫秒)
+	GetShutdownTimeout() int
+
+	// 幂等key的保留时间(秒), 0使用默认值
+	GetIdempotencyWindow() int
+
+	// 每个编号保留的历史持有者数量, 0使用默认值, 负数表示不记录
+	GetHistorySize() int
+
+	// 每秒允许的请求数, 0使用默认值, 负数表示不限流
+	GetRateLimit() int
+
+	// 同时持有编号数的上限
+	GetQuota() QuotaConf
+
+	// 是否拒绝为未注册的服务分配编号
+	IsRegistrationRequired() bool
+
+	// 编号生命周期事件的通知设置
+	GetWebhook() WebhookConf
+	GetAudit() AuditConf
+
+	// 远程配置
+	GetRemoteConfig() RemoteConf
+
+	// 存储后端, 以及迁移期间同时写入的后端
+	GetStore() StoreConf
+	GetMirror() StoreConf
+
+	// 接口鉴权设置
+	GetAuth() AuthConf
+}
+
+// AuthConf 接口鉴权设置, Tokens为空时不鉴权
+type AuthConf struct {
+	Tokens []AuthToken `json:"tokens"`
+}
+
+// AuthToken 通过Authorization: Bearer <Token>鉴权的调用方.
+// 非管理员只能访问Tenant(为空时为默认租户), 管理员可以访问管理接口和所有租户
+type AuthToken struct {
+	Token  string `json:"token"`
+	Name   string `json:"name"`
+	Tenant string `json:"tenant"`
+	Admin  bool   `json:"admin"`
+}
+
+// StoreConf 存储后端设置, Backend为consul、etcd或bolt, Addr为地址或bolt文件.
+// store中的Backend为空时使用consul, consul的Addr为空时使用consulAddr; mirror中的Backend为空时不双写
+type StoreConf struct {
+	Backend string `json:"backend"`
+	Addr    string `json:"addr"`
+}
+
+// AuditConf 审计日志设置, Backend为kv时写入存储后端, 为bolt时写入本地文件Path, 为空时不记录
+type AuditConf struct {
+	Backend       string `json:"backend"`
+	Path          string `json:"path"`
+	RetentionDays int    `json:"retentionDays"` // 保留天数, 0为默认30天, 小于0不清理
+}
+
+// WebhookConf 通知设置, Endpoints为空时不发送通知
+type WebhookConf struct {
+	Queue       string            `json:"queue"`       // 本地队列文件
+	Timeout     int               `json:"timeout"`     // 单次请求超时(毫秒)
+	MaxAttempts int               `json:"maxAttempts"` // 最大投递次数
+	Endpoints   []WebhookEndpoint `json:"endpoints"`
+}
+
+// WebhookEndpoint 接收通知的地址, Events为空表示接收所有事件
+type WebhookEndpoint struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// QuotaConf 配额配置, 0表示不限制
+type QuotaConf struct {
+	Service  int            `json:"service"`  // 每个服务的默认上限
+	Tenant   int            `json:"tenant"`   // 每个租户的默认上限
+	Services map[string]int `json:"services"` // key为服务名, 非默认租户为tenant/service
+	Tenants  map[string]int `json:"tenants"`
 }
 
 // appConfig 服务配置
@@ -32,6 +130,30 @@ type appConfig struct {
 	ServerID   int    `json:"serverId"`
 	NodeID     int    `json:"nodeId"`
 	ConsulAddr string `json:"consulAddr"`
+
+	TraceExporter string `json:"traceExporter"`
+	TraceEndpoint string `json:"traceEndpoint"`
+
+	RequestTimeout  int `json:"requestTimeout"`
+	ShutdownTimeout int `json:"shutdownTimeout"`
+
+	IdempotencyWindow int `json:"idempotencyWindow"`
+	HistorySize       int `json:"historySize"`
+
+	RateLimit int       `json:"rateLimit"`
+	Quota     QuotaConf `json:"quota"`
+
+	RequireRegistration bool `json:"requireRegistration"`
+
+	Webhook WebhookConf `json:"webhook"`
+	Audit   AuditConf   `json:"audit"`
+
+	RemoteConfig RemoteConf `json:"remoteConfig"`
+
+	Store  StoreConf `json:"store"`
+	Mirror StoreConf `json:"mirror"`
+
+	Auth AuthConf `json:"auth"`
 }
 
 // IsDebugMode ...
@@ -63,7 +185,125 @@ func (s *appConfig) GetConsulAddr() string {
 	return s.ConsulAddr
 }
 
-// 加载服务相关配置
+// GetTraceExporter ...
+func (s *appConfig) GetTraceExporter() string {
+	return s.TraceExporter
+}
+
+// GetTraceEndpoint ...
+func (s *appConfig) GetTraceEndpoint() string {
+	return s.TraceEndpoint
+}
+
+// GetRequestTimeout ...
+func (s *appConfig) GetRequestTimeout() int {
+	return s.RequestTimeout
+}
+
+// GetShutdownTimeout ...
+func (s *appConfig) GetShutdownTimeout() int {
+	return s.ShutdownTimeout
+}
+
+// GetIdempotencyWindow ...
+func (s *appConfig) GetIdempotencyWindow() int {
+	return s.IdempotencyWindow
+}
+
+// GetHistorySize ...
+func (s *appConfig) GetHistorySize() int {
+	return s.HistorySize
+}
+
+// GetRateLimit ...
+func (s *appConfig) GetRateLimit() int {
+	return s.RateLimit
+}
+
+// GetQuota ...
+func (s *appConfig) GetQuota() QuotaConf {
+	return s.Quota
+}
+
+// IsRegistrationRequired ...
+func (s *appConfig) IsRegistrationRequired() bool {
+	return s.RequireRegistration
+}
+
+// GetWebhook ...
+func (s *appConfig) GetWebhook() WebhookConf {
+	return s.Webhook
+}
+
+// GetAudit ...
+func (s *appConfig) GetAudit() AuditConf {
+	return s.Audit
+}
+
+// GetRemoteConfig ...
+func (s *appConfig) GetRemoteConfig() RemoteConf {
+	return s.RemoteConfig
+}
+
+// GetStore ...
+func (s *appConfig) GetStore() StoreConf {
+	c := s.Store
+	if c.Backend == "" {
+		c.Backend = "consul"
+	}
+	if c.Backend == "consul" && c.Addr == "" {
+		c.Addr = s.ConsulAddr
+	}
+	return c
+}
+
+// GetMirror ...
+func (s *appConfig) GetMirror() StoreConf {
+	return s.Mirror
+}
+
+// GetAuth ...
+func (s *appConfig) GetAuth() AuthConf {
+	return s.Auth
+}
+
+// 加载服务相关配置, 依次合并本地文件、conf.d中的片段、远程配置、环境变量和命令行参数
+// 最后再检查合并后的配置, 不合法时不使用
 func loadServerConf(filePath string, c *config) bool {
-	return loadConfFromFile(filePath, &c.appConfig)
+	lastErr = loadServer(filePath, &c.appConfig)
+	if lastErr != nil {
+		log.Error().Err(lastErr).Str("fileName", filePath).Msg("load config failed")
+		return false
+	}
+	return true
+}
+
+func loadServer(filePath string, c *appConfig) error {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) && !confExplicit {
+		log.Info().Str("fileName", filePath).Msg("config file not found, use env and flags only")
+	} else if err := loadConfFromFile(filePath, c); err != nil {
+		return err
+	}
+
+	for _, file := range fragments() {
+		if err := loadConfFromFile(file, c); err != nil {
+			return err
+		}
+	}
+
+	// 远程配置的地址可能来自环境变量或命令行参数
+	local := *c
+	if err := applyOverrides(&local); err != nil {
+		return err
+	}
+	c.ConsulAddr, c.Store, c.RemoteConfig = local.ConsulAddr, local.Store, local.RemoteConfig
+
+	if err := loadRemoteConf(c); err != nil {
+		return err
+	}
+
+	if err := applyOverrides(c); err != nil {
+		return err
+	}
+	return c.Validate()
 }
@@ -1,25 +1,34 @@
 package config
 
 import (
-	"encoding/json"
 	"io/ioutil"
-	"os"
-	"runtime/debug"
 	"sync"
 	"sync/atomic"
-	"time"
 	"unsafe"
 
 	"nodeid/pkg/log"
 )
 
-const timespan = 1 //1秒检测一次文件变更状态
+const timespan = 1 //不支持fsnotify时, 1秒检测一次文件变更状态
 
 type watchCallback func(string, *config) bool //检测到文件变更后的回调
 
 var conf *config
 var once sync.Once
 
+// reloadMu 文件和远程配置的重新加载可能同时发生
+var reloadMu sync.Mutex
+
+// lastErr 最近一次加载失败的原因
+var lastErr error
+
+// LoadError 返回最近一次加载配置失败的原因, 用于说明Instance返回空的原因
+func LoadError() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return lastErr
+}
+
 // Conf ...
 type Conf interface {
 	AppConf
@@ -32,11 +41,14 @@ type config struct {
 // Instance ...
 func Instance() Conf {
 	once.Do(func() {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
 		conf = new(config)
 		confList := make(map[string]watchCallback)
 
 		//需要检测的文件列表
-		confList[serverConfFile] = loadServerConf
+		confList[confFile] = loadServerConf
 
 		//应用启动后，立即执行一次加载
 		for file, fun := range confList {
@@ -46,67 +58,49 @@ func Instance() Conf {
 			}
 		}
 
-		//定时检测加载
-		go checkConfigUpdate(confList)
+		//检测文件变更后重新加载
+		go checkConfigUpdate(confList, nil)
 	})
 
-	return conf
+	//重新加载时会替换conf
+	return (*config)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&conf))))
 }
 
-func checkConfigUpdate(configList map[string]watchCallback) {
-	t := time.NewTicker(timespan * time.Second)
-	fileMap := make(map[string]int64)
+// reload 和启动时一样从空的配置开始加载, 删除的配置项恢复为默认值. 成功后替换并通知订阅者
+func reload(file string, fun watchCallback) bool {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
 
-	defer func() {
-		if err := recover(); err != nil {
-			log.Error().Str("stackInfo", string(debug.Stack())).Msg("painc and recover")
-		}
-		t.Stop()
-	}()
-
-	for range t.C {
-		checkFileStat(configList, fileMap)
+	oldConf := conf
+	if oldConf == nil {
+		return false
 	}
-}
 
-func checkFileStat(configList map[string]watchCallback, fileMap map[string]int64) {
-	for file, fun := range configList {
-		if fi, err := os.Stat(file); err == nil {
-			curModifyTime := fi.ModTime().Unix()
-
-			if lastModifyTime, ok := fileMap[file]; ok {
-				if curModifyTime > lastModifyTime {
-					tempConf := *conf
-					if fun(file, &tempConf) {
-						fileMap[file] = curModifyTime
-						//保证业务中使用配置的原子性
-						atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&conf)), unsafe.Pointer(&tempConf))
-					} else {
-						log.Error().Str("confName", file).Msg("load file failed.")
-					}
-				}
-			} else {
-				fileMap[file] = curModifyTime
-				log.Info().Str("fileName", file).Msg("checkConfigUpdate")
-			}
-		}
+	tempConf := config{}
+	if !fun(file, &tempConf) {
+		return false
 	}
+
+	//保证业务中使用配置的原子性
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&conf)), unsafe.Pointer(&tempConf))
+	notify(oldConf, &tempConf)
+	return true
 }
 
-func loadConfFromFile(filePath string, i interface{}) bool {
+func loadConfFromFile(filePath string, i interface{}) error {
 	bs, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		log.Error().Err(err).Str("fileName", filePath).Msg("config read file failed")
-		return false
+		return err
 	}
 
-	err = json.Unmarshal(bs, i)
+	err = decodeConf(filePath, bs, i)
 	if err != nil {
 		log.Error().Err(err).Str("fileName", filePath).Msg("parse config error")
-		return false
+		return err
 	}
 
 	log.Info().Str("path", filePath).Interface("confContext", i).Msg("load config successfully")
 
-	return true
+	return nil
 }
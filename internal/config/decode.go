@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeConf 按扩展名选择格式, 支持json、yaml、toml.
+// 所有格式共用json tag, 字段名区分大小写, 不认识的字段返回错误
+func decodeConf(filePath string, data []byte, i interface{}) (err error) {
+	m := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(filePath)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &m)
+	case ".yaml", ".yml":
+		if err = yaml.Unmarshal(data, &m); err == nil {
+			data, err = json.Marshal(m)
+		}
+	case ".toml":
+		if _, err = toml.Decode(string(data), &m); err == nil {
+			data, err = json.Marshal(m)
+		}
+	default:
+		return errors.Errorf("unsupported config format %q", ext)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := checkKeys(m, reflect.TypeOf(i).Elem(), ""); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, i)
+}
+
+// checkKeys 检查m中的key都是t中字段的json tag, 嵌套的结构体、切片和数组递归检查
+func checkKeys(m map[string]interface{}, t reflect.Type, prefix string) error {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+
+	for key, value := range m {
+		ft, ok := fields[key]
+		if !ok {
+			return errors.Errorf("unknown config key %q", prefix+key)
+		}
+		if err := checkValue(value, ft, prefix+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkValue 按字段类型检查value, 切片元素的路径为key[i]
+func checkValue(value interface{}, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if sub, ok := value.(map[string]interface{}); ok {
+			return checkKeys(sub, t, path+".")
+		}
+	case reflect.Slice, reflect.Array:
+		// toml的表数组解析为[]map[string]interface{}, 其他格式为[]interface{}
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := checkValue(v.Index(i).Interface(), t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
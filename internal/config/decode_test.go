@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeConf(t *testing.T) {
+	cases := []struct {
+		file, data string
+		err        string
+	}{
+		{"app.json", `{"httpPort":8080,"webhook":{"endpoints":[{"url":"http://a","secret":"s"}]}}`, ""},
+		{"app.json", `{"httpPrt":8080}`, `unknown config key "httpPrt"`},
+		{"app.json", `{"audit":{"bakend":"kv"}}`, `unknown config key "audit.bakend"`},
+		{"app.json", `{"webhook":{"endpoints":[{"url":"http://a"},{"url":"http://b","secert":"s"}]}}`,
+			`unknown config key "webhook.endpoints[1].secert"`},
+		{"app.yaml", "webhook:\n  endpoints:\n    - url: http://a\n      secert: s\n",
+			`unknown config key "webhook.endpoints[0].secert"`},
+		{"app.toml", "[[webhook.endpoints]]\nurl = \"http://a\"\nsecert = \"s\"\n",
+			`unknown config key "webhook.endpoints[0].secert"`},
+		{"app.toml", "[[auth.tokens]]\ntoken = \"t\"\nname = \"ops\"\nadmin = true\n", ""},
+		{"app.ini", "", `unsupported config format ".ini"`},
+	}
+	for _, c := range cases {
+		err := decodeConf(c.file, []byte(c.data), &appConfig{})
+		if c.err == "" {
+			assert.NoError(t, err, c.data)
+		} else {
+			assert.EqualError(t, err, c.err, c.data)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// 配置的优先级从高到低: 命令行参数 > 环境变量 > 配置文件.
+// 每个配置项都可以覆盖, 名字由json tag转换而来, 嵌套的配置用父级名字作前缀, 例如
+//
+//	httpPort      --http-port      NODEID_HTTP_PORT
+//	quota.service --quota-service  NODEID_QUOTA_SERVICE
+//
+// map、slice等非基本类型使用json表示. 配置文件重新加载后会再次应用覆盖
+const envPrefix = "NODEID_"
+
+// EnvConfigFile 指定配置文件的环境变量, --config优先
+const EnvConfigFile = envPrefix + "CONFIG"
+
+// EnvConfigDir 指定配置片段目录的环境变量, --conf-dir优先
+const EnvConfigDir = envPrefix + "CONF_DIR"
+
+var (
+	// confFile 配置文件路径, 使用默认路径且文件不存在时只从环境变量和命令行参数读取
+	confFile     = serverConfFile
+	confExplicit bool
+
+	// confDir 配置片段目录, 为空时使用配置文件所在目录下的conf.d
+	confDir string
+
+	// flagOverrides 命令行中设置过的配置项, key为json路径
+	flagOverrides = make(map[string]string)
+)
+
+func init() {
+	if file := os.Getenv(EnvConfigFile); file != "" {
+		confFile, confExplicit = file, true
+	}
+	confDir = os.Getenv(EnvConfigDir)
+}
+
+func confDirPath() string {
+	if confDir != "" {
+		return confDir
+	}
+	return filepath.Join(filepath.Dir(confFile), "conf.d")
+}
+
+// RegisterFlags 注册--config和所有配置项对应的命令行参数, 需要在Instance之前解析
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.Var(fileFlag{}, "config", "config file path, env "+EnvConfigFile)
+	fs.Var(dirFlag{}, "conf-dir", "config fragments directory, default conf.d next to config file, env "+EnvConfigDir)
+
+	walkFields(reflect.ValueOf(&appConfig{}).Elem(), nil, func(path []string, v reflect.Value) {
+		fs.Var(&fieldFlag{path: strings.Join(path, "."), typ: v.Type()},
+			flagName(path), "override "+strings.Join(path, ".")+", env "+envName(path))
+	})
+}
+
+type fileFlag struct{}
+
+func (fileFlag) String() string {
+	return confFile
+}
+
+func (fileFlag) Set(s string) error {
+	confFile, confExplicit = s, true
+	return nil
+}
+
+type dirFlag struct{}
+
+func (dirFlag) String() string {
+	return confDir
+}
+
+func (dirFlag) Set(s string) error {
+	confDir = s
+	return nil
+}
+
+type fieldFlag struct {
+	path string
+	typ  reflect.Type
+}
+
+func (f *fieldFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return flagOverrides[f.path]
+}
+
+// IsBoolFlag 布尔类型的参数可以省略值, 如--debug-mode
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.typ.Kind() == reflect.Bool
+}
+
+// Set 先校验值能否转换为配置项的类型, 错误在解析命令行时就返回
+func (f *fieldFlag) Set(s string) error {
+	if err := setField(reflect.New(f.typ).Elem(), s); err != nil {
+		return err
+	}
+	flagOverrides[f.path] = s
+	return nil
+}
+
+// applyOverrides 依次应用环境变量和命令行参数
+func applyOverrides(c *appConfig) (err error) {
+	walkFields(reflect.ValueOf(c).Elem(), nil, func(path []string, v reflect.Value) {
+		if err != nil {
+			return
+		}
+		if s, ok := os.LookupEnv(envName(path)); ok {
+			if e := setField(v, s); e != nil {
+				err = errors.Wrapf(e, "env %s", envName(path))
+				return
+			}
+		}
+		if s, ok := flagOverrides[strings.Join(path, ".")]; ok {
+			if e := setField(v, s); e != nil {
+				err = errors.Wrapf(e, "flag --%s", flagName(path))
+			}
+		}
+	})
+	return
+}
+
+// walkFields 遍历结构体中带json tag的字段, 嵌套的结构体展开为叶子节点
+func walkFields(v reflect.Value, prefix []string, fn func(path []string, v reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		path := append(append([]string{}, prefix...), name)
+		if fv := v.Field(i); fv.Kind() == reflect.Struct {
+			walkFields(fv, path, fn)
+		} else {
+			fn(path, fv)
+		}
+	}
+}
+
+func setField(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	default:
+		ptr := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(s), ptr.Interface()); err != nil {
+			return err
+		}
+		v.Set(ptr.Elem())
+	}
+	return nil
+}
+
+// splitWords 按驼峰拆分json名字, httpPort -> [http port]
+func splitWords(path []string) []string {
+	var words []string
+	for _, name := range path {
+		start := 0
+		for i, r := range name {
+			if i > 0 && unicode.IsUpper(r) {
+				words = append(words, strings.ToLower(name[start:i]))
+				start = i
+			}
+		}
+		words = append(words, strings.ToLower(name[start:]))
+	}
+	return words
+}
+
+func envName(path []string) string {
+	return envPrefix + strings.ToUpper(strings.Join(splitWords(path), "_"))
+}
+
+func flagName(path []string) string {
+	return strings.Join(splitWords(path), "-")
+}
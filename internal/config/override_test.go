@@ -0,0 +1,78 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverrideNames(t *testing.T) {
+	assert.Equal(t, "NODEID_HTTP_PORT", envName([]string{"httpPort"}))
+	assert.Equal(t, "http-port", flagName([]string{"httpPort"}))
+	assert.Equal(t, "NODEID_QUOTA_SERVICES", envName([]string{"quota", "services"}))
+	assert.Equal(t, "audit-retention-days", flagName([]string{"audit", "retentionDays"}))
+}
+
+func TestApplyOverrides(t *testing.T) {
+	defer func() { flagOverrides = make(map[string]string) }()
+	for k, v := range map[string]string{
+		"NODEID_HTTP_PORT":      "9000",
+		"NODEID_SERVER_NAME":    "env",
+		"NODEID_QUOTA_SERVICES": `{"foo":3}`,
+	} {
+		assert.NoError(t, os.Setenv(k, v))
+		defer os.Unsetenv(k)
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(&bytes.Buffer{})
+	RegisterFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"--http-port", "9001", "--debug-mode", "--quota-service=2"}))
+
+	c := &appConfig{HTTPPort: 8080, ServerName: "file", LogLevel: 1}
+	assert.NoError(t, applyOverrides(c))
+	// 命令行参数 > 环境变量 > 配置文件
+	assert.Equal(t, 9001, c.HTTPPort)
+	assert.Equal(t, "env", c.ServerName)
+	assert.Equal(t, 1, c.LogLevel)
+	assert.True(t, c.DebugMode)
+	assert.Equal(t, 2, c.Quota.Service)
+	assert.Equal(t, map[string]int{"foo": 3}, c.Quota.Services)
+
+	// 命令行参数类型错误在解析时返回
+	assert.Error(t, fs.Parse([]string{"--http-port", "abc"}))
+
+	assert.NoError(t, os.Setenv("NODEID_LOG_LEVEL", "debug"))
+	defer os.Unsetenv("NODEID_LOG_LEVEL")
+	err := applyOverrides(&appConfig{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "env NODEID_LOG_LEVEL")
+	}
+}
+
+func TestLoadServerFromEnv(t *testing.T) {
+	file, explicit := confFile, confExplicit
+	defer func() { confFile, confExplicit = file, explicit }()
+	confFile, confExplicit = t.TempDir()+"/app.json", false
+
+	for k, v := range map[string]string{
+		"NODEID_SERVER_NAME": "nodeid",
+		"NODEID_HTTP_PORT":   "9000",
+		"NODEID_CONSUL_ADDR": "127.0.0.1:8500",
+	} {
+		assert.NoError(t, os.Setenv(k, v))
+		defer os.Unsetenv(k)
+	}
+
+	// 默认路径的文件不存在时只使用环境变量和命令行参数
+	c := &appConfig{}
+	assert.NoError(t, loadServer(confFile, c))
+	assert.Equal(t, 9000, c.HTTPPort)
+
+	// 明确指定的文件必须存在
+	confExplicit = true
+	assert.Error(t, loadServer(confFile, &appConfig{}))
+}
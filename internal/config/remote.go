@@ -0,0 +1,152 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"nodeid/pkg/log"
+	"nodeid/pkg/nid"
+
+	"github.com/docker/libkv/store"
+	"github.com/pkg/errors"
+)
+
+const remoteRetryInterval = 5 * time.Second
+
+// RemoteConf 从存储后端读取配置, 覆盖本地文件中的同名配置项, Key为空时不使用.
+// 后端为store中的backend和addr, remoteConfig、store和consulAddr只从本地读取.
+// 不支持监听的后端(bolt)每隔一段时间重新读取
+type RemoteConf struct {
+	Key   string `json:"key"`   // 配置所在的key, 格式按扩展名判断, 没有扩展名时为json
+	Cache string `json:"cache"` // 最近一次读取成功的配置保存到本地, 后端不可用时使用
+}
+
+// remoteSource 远程配置的来源, 后端或key变化时重新创建
+type remoteSource struct {
+	sc   StoreConf
+	conf RemoteConf
+	kv   store.Store
+	stop chan struct{}
+}
+
+var (
+	remoteMu sync.Mutex
+	remote   *remoteSource
+)
+
+// remoteSourceFor 返回sc和rc对应的来源, 并开始监听变更
+func remoteSourceFor(sc StoreConf, rc RemoteConf) (*remoteSource, error) {
+	remoteMu.Lock()
+	defer remoteMu.Unlock()
+
+	if remote != nil {
+		if remote.sc == sc && remote.conf == rc {
+			return remote, nil
+		}
+		close(remote.stop)
+		remote.kv.Close()
+		remote = nil
+	}
+	if rc.Key == "" {
+		return nil, nil
+	}
+
+	kv, err := nid.OpenStore(sc.Backend, sc.Addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "connect remote config")
+	}
+
+	remote = &remoteSource{sc: sc, conf: rc, kv: kv, stop: make(chan struct{})}
+	go remote.watch()
+	return remote, nil
+}
+
+// fetch 读取远程配置, key不存在时返回空. 后端不可用时使用本地缓存
+func (s *remoteSource) fetch() ([]byte, error) {
+	pair, err := s.kv.Get(s.conf.Key)
+	if err == store.ErrKeyNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		if s.conf.Cache == "" {
+			return nil, errors.Wrap(err, "read remote config")
+		}
+		log.Warn().Err(err).Str("key", s.conf.Key).Str("cache", s.conf.Cache).Msg("remote config unavailable, use cache")
+		data, e := ioutil.ReadFile(s.conf.Cache)
+		if e != nil {
+			return nil, errors.Wrap(err, "read remote config")
+		}
+		return data, nil
+	}
+
+	if s.conf.Cache != "" {
+		if err := ioutil.WriteFile(s.conf.Cache, pair.Value, 0600); err != nil {
+			log.Warn().Err(err).Str("cache", s.conf.Cache).Msg("save remote config cache")
+		}
+	}
+	return pair.Value, nil
+}
+
+// watch 远程配置变化时重新加载, 后端不可用时保持当前配置, 稍后重新监听
+func (s *remoteSource) watch() {
+	var last uint64
+	for {
+		ch, err := s.kv.Watch(s.conf.Key, s.stop)
+		switch {
+		case err == nil:
+			for range ch {
+				s.reload()
+			}
+		case err == store.ErrCallNotSupported:
+			// 不支持监听时比较版本号, 变化时重新加载
+			if pair, err := s.kv.Get(s.conf.Key); err == nil {
+				if last != 0 && pair.LastIndex != last {
+					s.reload()
+				}
+				last = pair.LastIndex
+			}
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(remoteRetryInterval):
+		}
+	}
+}
+
+func (s *remoteSource) reload() {
+	if !reload(confFile, loadServerConf) {
+		log.Error().Str("key", s.conf.Key).Msg("reload remote config failed")
+	}
+}
+
+// loadRemoteConf 把远程配置合并到c中
+func loadRemoteConf(c *appConfig) error {
+	local := *c
+	src, err := remoteSourceFor(local.GetStore(), local.RemoteConfig)
+	if err != nil || src == nil {
+		return err
+	}
+
+	data, err := src.fetch()
+	if err != nil || data == nil {
+		return err
+	}
+
+	name := src.conf.Key
+	if filepath.Ext(name) == "" {
+		name += ".json"
+	}
+	if err := decodeConf(name, data, c); err != nil {
+		return errors.Wrapf(err, "remote config %s", src.conf.Key)
+	}
+
+	c.ConsulAddr = local.ConsulAddr
+	c.Store = local.Store
+	c.RemoteConfig = local.RemoteConfig
+	return nil
+}
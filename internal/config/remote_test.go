@@ -0,0 +1,52 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"nodeid/pkg/nid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRemoteConf(t *testing.T) {
+	dir := t.TempDir()
+	named, err := nid.NewBoltNamed(dir + "/node.bolt")
+	assert.NoError(t, err)
+	assert.NoError(t, named.PutKey(context.Background(), "config/nodeid.yaml",
+		[]byte("httpPort: 9090\nstore:\n  backend: consul\n"), nil))
+
+	sc := StoreConf{Backend: "bolt", Addr: dir + "/node.bolt"}
+	rc := RemoteConf{Key: "config/nodeid.yaml", Cache: dir + "/remote.cache"}
+	defer remoteSourceFor(sc, RemoteConf{})
+
+	c := &appConfig{HTTPPort: 8080, Store: sc, RemoteConfig: rc}
+	assert.NoError(t, loadRemoteConf(c))
+	assert.Equal(t, 9090, c.HTTPPort)
+	// 后端设置只从本地读取
+	assert.Equal(t, sc, c.Store)
+
+	cached, err := ioutil.ReadFile(rc.Cache)
+	assert.NoError(t, err)
+	assert.Contains(t, string(cached), "httpPort: 9090")
+}
+
+func TestLoadRemoteConfCache(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(dir+"/remote.cache", []byte(`{"httpPort":9091}`), 0600))
+	// bolt文件损坏, 读取失败时使用缓存
+	assert.NoError(t, ioutil.WriteFile(dir+"/node.bolt", []byte("not a bolt file"), 0600))
+
+	sc := StoreConf{Backend: "bolt", Addr: dir + "/node.bolt"}
+	rc := RemoteConf{Key: "config/nodeid", Cache: dir + "/remote.cache"}
+	defer remoteSourceFor(sc, RemoteConf{})
+
+	c := &appConfig{Store: sc, RemoteConfig: rc}
+	assert.NoError(t, loadRemoteConf(c))
+	assert.Equal(t, 9091, c.HTTPPort)
+
+	rc.Cache = ""
+	c = &appConfig{Store: sc, RemoteConfig: rc}
+	assert.Error(t, loadRemoteConf(c))
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Change 配置重新加载后通知给订阅者, Keys为发生变化的配置项, 如quota.service
+type Change struct {
+	Old  Conf
+	New  Conf
+	Keys []string
+}
+
+// Has 判断key或key下的子项是否变化
+func (c *Change) Has(key string) bool {
+	for _, k := range c.Keys {
+		if k == key || strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Listener 在检测配置的协程中依次调用, 不应阻塞
+type Listener func(*Change)
+
+var (
+	listenerMu sync.Mutex
+	listeners  []Listener
+)
+
+// Subscribe 注册配置变更的回调, 配置内容没有变化时不通知
+func Subscribe(l Listener) {
+	listenerMu.Lock()
+	defer listenerMu.Unlock()
+	listeners = append(listeners, l)
+}
+
+func notify(old, new *config) {
+	keys := diffFields(reflect.ValueOf(&old.appConfig).Elem(), reflect.ValueOf(&new.appConfig).Elem(), nil)
+	if len(keys) == 0 {
+		return
+	}
+
+	listenerMu.Lock()
+	ls := append([]Listener{}, listeners...)
+	listenerMu.Unlock()
+
+	change := &Change{Old: old, New: new, Keys: keys}
+	for _, l := range ls {
+		l(change)
+	}
+}
+
+// diffFields 返回两个配置中值不同的配置项
+func diffFields(a, b reflect.Value, prefix []string) []string {
+	var keys []string
+	walkFields(a, prefix, func(path []string, v reflect.Value) {
+		w := b
+		for _, name := range path {
+			w = fieldByTag(w, name)
+		}
+		if !reflect.DeepEqual(v.Interface(), w.Interface()) {
+			keys = append(keys, strings.Join(path, "."))
+		}
+	})
+	return keys
+}
+
+func fieldByTag(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadNotify(t *testing.T) {
+	oldConf, oldListeners := conf, listeners
+	defer func() { conf, listeners = oldConf, oldListeners }()
+	conf, listeners = &config{appConfig{HTTPPort: 8080, RateLimit: 10}}, nil
+
+	var changes []*Change
+	Subscribe(func(ch *Change) { changes = append(changes, ch) })
+	load := func(c appConfig, ok bool) watchCallback {
+		return func(_ string, dst *config) bool {
+			dst.appConfig = c
+			return ok
+		}
+	}
+
+	next := appConfig{HTTPPort: 8080, RateLimit: 20, Quota: QuotaConf{Service: 3}}
+	assert.True(t, reload("app.json", load(next, true)))
+	if assert.Len(t, changes, 1) {
+		ch := changes[0]
+		assert.Equal(t, []string{"rateLimit", "quota.service"}, ch.Keys)
+		assert.True(t, ch.Has("quota"))
+		assert.False(t, ch.Has("quo"))
+		assert.Equal(t, 10, ch.Old.GetRateLimit())
+		assert.Equal(t, 20, ch.New.GetRateLimit())
+	}
+	assert.Equal(t, 20, conf.GetRateLimit())
+
+	// 内容没有变化时不通知
+	assert.True(t, reload("app.json", load(next, true)))
+	assert.Len(t, changes, 1)
+
+	// 加载失败时保留原来的配置
+	assert.False(t, reload("app.json", load(appConfig{RateLimit: 30}, false)))
+	assert.Equal(t, 20, conf.GetRateLimit())
+	assert.Len(t, changes, 1)
+}
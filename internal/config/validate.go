@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// ValidationError 配置中所有不合法的地方, 每项一条可读的描述
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e, "; ")
+}
+
+var (
+	traceExporters = []string{"", "stdout", "otlp"}
+	auditBackends  = []string{"", "kv", "bolt"}
+	storeBackends  = []string{"consul", "etcd", "bolt"}
+	eventTypes     = []string{nid.EventAllocated, nid.EventRecovered, nid.EventReclaimed, nid.EventReleased, nid.EventEvicted}
+)
+
+// Validate 检查配置, 合法时返回nil, 否则返回ValidationError
+func (s *appConfig) Validate() error {
+	var errs ValidationError
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(s.ServerName != "", "serverName is required")
+	check(s.HTTPPort > 0 && s.HTTPPort <= 65535, "httpPort %d is out of range [1, 65535]", s.HTTPPort)
+	check(s.LogLevel >= int(zerolog.TraceLevel) && s.LogLevel <= int(zerolog.Disabled),
+		"logLevel %d is out of range [%d, %d]", s.LogLevel, zerolog.TraceLevel, zerolog.Disabled)
+	check(s.NodeID >= 0 && s.NodeID <= nid.MaxNodeID, "nodeId %d is out of range [0, %d]", s.NodeID, nid.MaxNodeID)
+	// consulAddr在使用consul存储且没有配置store.addr时需要
+	sc := s.GetStore()
+	if sc.Backend == "consul" && s.Store.Addr == "" {
+		check(validAddr(s.ConsulAddr), "consulAddr %q must be host:port", s.ConsulAddr)
+	}
+	check(oneOf(sc.Backend, storeBackends), "store.backend %q must be one of %q", sc.Backend, storeBackends)
+	if sc.Backend == "bolt" {
+		check(sc.Addr != "", "store.addr is required for bolt backend")
+	} else if s.Store.Addr != "" {
+		check(validAddr(sc.Addr), "store.addr %q must be host:port", sc.Addr)
+	}
+	if s.Mirror.Backend != "" {
+		check(oneOf(s.Mirror.Backend, storeBackends), "mirror.backend %q must be one of %q", s.Mirror.Backend, storeBackends)
+		check(s.Mirror.Addr != "", "mirror.addr is required")
+		check(s.Mirror.Backend == "bolt" || s.Mirror.Addr == "" || validAddr(s.Mirror.Addr),
+			"mirror.addr %q must be host:port", s.Mirror.Addr)
+		check(s.Mirror != sc, "mirror must differ from store")
+	}
+
+	check(oneOf(s.TraceExporter, traceExporters), "traceExporter %q must be one of %q", s.TraceExporter, traceExporters)
+	check(s.TraceExporter != "otlp" || s.TraceEndpoint == "" || validAddr(s.TraceEndpoint),
+		"traceEndpoint %q must be host:port", s.TraceEndpoint)
+
+	check(s.RequestTimeout >= 0, "requestTimeout must not be negative")
+	check(s.ShutdownTimeout >= 0, "shutdownTimeout must not be negative")
+	check(s.IdempotencyWindow >= 0, "idempotencyWindow must not be negative")
+
+	check(s.Quota.Service >= 0, "quota.service must not be negative")
+	check(s.Quota.Tenant >= 0, "quota.tenant must not be negative")
+	for name, n := range s.Quota.Services {
+		check(n >= 0, "quota.services[%s] must not be negative", name)
+	}
+	for name, n := range s.Quota.Tenants {
+		check(n >= 0, "quota.tenants[%s] must not be negative", name)
+	}
+
+	if len(s.Webhook.Endpoints) > 0 {
+		check(s.Webhook.Queue != "", "webhook.queue is required when endpoints are set")
+	}
+	check(s.Webhook.Timeout >= 0, "webhook.timeout must not be negative")
+	check(s.Webhook.MaxAttempts >= 0, "webhook.maxAttempts must not be negative")
+	urls := make(map[string]bool, len(s.Webhook.Endpoints))
+	for i, e := range s.Webhook.Endpoints {
+		u, err := url.Parse(e.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"webhook.endpoints[%d].url %q must be an http(s) url", i, e.URL)
+		check(!urls[e.URL], "webhook.endpoints[%d].url %q is duplicated", i, e.URL)
+		urls[e.URL] = true
+		for _, ev := range e.Events {
+			check(oneOf(ev, eventTypes), "webhook.endpoints[%d].events: unknown event %q", i, ev)
+		}
+	}
+
+	check(oneOf(s.Audit.Backend, auditBackends), "audit.backend %q must be one of %q", s.Audit.Backend, auditBackends)
+	check(s.Audit.Backend != "bolt" || s.Audit.Path != "", "audit.path is required for bolt backend")
+
+	tokens := make(map[string]bool, len(s.Auth.Tokens))
+	for i, t := range s.Auth.Tokens {
+		check(t.Token != "", "auth.tokens[%d].token is required", i)
+		check(t.Name != "", "auth.tokens[%d].name is required", i)
+		check(!tokens[t.Token], "auth.tokens[%d].token is duplicated", i)
+		check(store.ValidName(t.Tenant, store.MaxTenantLen), "auth.tokens[%d].tenant %q is invalid", i, t.Tenant)
+		tokens[t.Token] = true
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateFile 检查配置文件, 不合并远程配置、环境变量和命令行参数.
+// conf.d中的片段只包含部分配置项, 和配置文件、排在它前面的片段按加载顺序合并后再检查
+func ValidateFile(filePath string) error {
+	c := &appConfig{}
+	for _, file := range layers(filePath) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := decodeConf(file, data, c); err != nil {
+			if file != filePath {
+				err = errors.Wrap(err, file)
+			}
+			return ValidationError{err.Error()}
+		}
+	}
+	return c.Validate()
+}
+
+// layers 返回检查filePath时需要依次加载的文件.
+// 片段所在的目录为片段目录或名为conf.d时, 先加载配置文件(不存在时跳过)和文件名排在前面的片段
+func layers(filePath string) []string {
+	dir := filepath.Dir(filePath)
+	base := ""
+	if sameDir(dir, confDirPath()) {
+		base = confFile
+	} else if filepath.Base(dir) == "conf.d" {
+		base = filepath.Join(filepath.Dir(dir), filepath.Base(confFile))
+	} else {
+		return []string{filePath}
+	}
+
+	var files []string
+	if _, err := os.Stat(base); err == nil {
+		files = append(files, base)
+	}
+	for _, f := range fragmentsIn(dir) {
+		if filepath.Base(f) >= filepath.Base(filePath) {
+			break
+		}
+		files = append(files, f)
+	}
+	return append(files, filePath)
+}
+
+func sameDir(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
+
+func validAddr(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	return err == nil && host != "" && port != ""
+}
+
+func oneOf(s string, list []string) bool {
+	for _, v := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
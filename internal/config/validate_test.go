@@ -0,0 +1,57 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, data string) string {
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	data, err := ioutil.ReadFile("../../config/app.json")
+	assert.NoError(t, err)
+	c := &appConfig{}
+	assert.NoError(t, decodeConf("app.json", data, c))
+	assert.NoError(t, c.Validate())
+
+	c.HTTPPort = 0
+	c.Store = StoreConf{Backend: "bolt"}
+	c.Auth.Tokens = []AuthToken{{Token: "t", Name: "a"}, {Token: "t", Tenant: "a b"}}
+	err = c.Validate()
+	var verr ValidationError
+	if assert.True(t, errors.As(err, &verr)) {
+		assert.Contains(t, verr, "httpPort 0 is out of range [1, 65535]")
+		assert.Contains(t, verr, "store.addr is required for bolt backend")
+		assert.Contains(t, verr, "auth.tokens[1].name is required")
+		assert.Contains(t, verr, "auth.tokens[1].token is duplicated")
+	}
+}
+
+func TestValidateFragment(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(dir+"/conf.d", 0700))
+	base, err := ioutil.ReadFile("../../config/app.json")
+	assert.NoError(t, err)
+	writeFile(t, dir+"/app.json", string(base))
+
+	port := writeFile(t, dir+"/conf.d/10-port.yaml", "httpPort: 9000\n")
+	assert.NoError(t, ValidateFile(port))
+
+	// 后面的片段不影响前面的片段
+	bad := writeFile(t, dir+"/conf.d/20-bad.json", `{"httpPort": 70000}`)
+	assert.NoError(t, ValidateFile(port))
+	assert.Error(t, ValidateFile(bad))
+
+	writeFile(t, dir+"/conf.d/05-typo.json", `{"httpPrt": 1}`)
+	assert.Error(t, ValidateFile(port))
+
+	// 不在片段目录中的文件单独检查
+	assert.Error(t, ValidateFile(writeFile(t, dir+"/partial.yaml", "httpPort: 9000\n")))
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"nodeid/pkg/log"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// debounce 连续的写入合并为一次加载
+const debounce = 200 * time.Millisecond
+
+// fragments 按文件名顺序返回conf.d目录中的配置片段, 目录不存在时返回空
+func fragments() []string {
+	return fragmentsIn(confDirPath())
+}
+
+func fragmentsIn(dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, fi := range infos {
+		switch strings.ToLower(filepath.Ext(fi.Name())) {
+		case ".json", ".yaml", ".yml", ".toml":
+			if !fi.IsDir() {
+				files = append(files, filepath.Join(dir, fi.Name()))
+			}
+		}
+	}
+	return files
+}
+
+// watchedFiles 配置文件和所有片段
+func watchedFiles() []string {
+	return append([]string{confFile}, fragments()...)
+}
+
+// checkConfigUpdate 监听配置文件变更并重新加载, stop关闭时返回, 为nil时一直运行
+func checkConfigUpdate(configList map[string]watchCallback, stop <-chan struct{}) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error().Str("stackInfo", string(debug.Stack())).Msg("painc and recover")
+		}
+	}()
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Warn().Err(err).Msg("fsnotify unavailable, poll config files")
+		pollConfig(configList, stop)
+		return
+	}
+	defer w.Close()
+
+	// 监听目录而不是文件, 编辑器保存时可能先删除再创建文件
+	confDir := filepath.Dir(confFile)
+	for _, dir := range []string{confDir, confDirPath()} {
+		if err := w.Add(dir); err != nil && !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("dir", dir).Msg("fsnotify add failed, poll config files")
+			pollConfig(configList, stop)
+			return
+		}
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			// conf.d在启动后才创建时补充监听
+			if filepath.Clean(ev.Name) == filepath.Clean(confDirPath()) && ev.Op&fsnotify.Create != 0 {
+				_ = w.Add(ev.Name)
+			}
+			if isConfigEvent(ev.Name) {
+				timer.Reset(debounce)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Error().Err(err).Msg("config watcher")
+		case <-timer.C:
+			reloadAll(configList)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func isConfigEvent(name string) bool {
+	name = filepath.Clean(name)
+	if name == filepath.Clean(confFile) {
+		return true
+	}
+	if filepath.Dir(name) != filepath.Clean(confDirPath()) {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		return true
+	}
+	return false
+}
+
+// pollConfig 不支持fsnotify时定时检查文件的修改时间和大小
+func pollConfig(configList map[string]watchCallback, stop <-chan struct{}) {
+	t := time.NewTicker(timespan * time.Second)
+	defer t.Stop()
+
+	last := fingerprint()
+	for {
+		select {
+		case <-t.C:
+			if cur := fingerprint(); cur != last {
+				last = cur
+				reloadAll(configList)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func fingerprint() string {
+	var b strings.Builder
+	for _, file := range watchedFiles() {
+		if fi, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", file, fi.ModTime().UnixNano(), fi.Size())
+		}
+	}
+	return b.String()
+}
+
+func reloadAll(configList map[string]watchCallback) {
+	for file, fun := range configList {
+		if !reload(file, fun) {
+			log.Error().Str("confName", file).Msg("load file failed.")
+		}
+	}
+}
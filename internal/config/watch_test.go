@@ -0,0 +1,77 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func current() *config {
+	return (*config)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&conf))))
+}
+
+func TestWatchConfDir(t *testing.T) {
+	oldConf, oldFile, oldExplicit, oldDir := conf, confFile, confExplicit, confDir
+	defer func() { conf, confFile, confExplicit, confDir = oldConf, oldFile, oldExplicit, oldDir }()
+
+	dir := t.TempDir()
+	base, err := ioutil.ReadFile("../../config/app.json")
+	assert.NoError(t, err)
+	confFile, confExplicit, confDir = writeFile(t, dir+"/app.json", string(base)), true, ""
+	conf = &config{}
+	assert.True(t, loadServerConf(confFile, conf))
+	assert.Equal(t, 5000, current().GetRateLimit())
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		checkConfigUpdate(map[string]watchCallback{confFile: loadServerConf}, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// conf.d在启动后创建, 片段写入可能早于补充监听, 每次检查前重写一次
+	assert.NoError(t, os.Mkdir(dir+"/conf.d", 0700))
+	assert.Eventually(t, func() bool {
+		writeFile(t, dir+"/conf.d/10-rate.yaml", "rateLimit: 7\n")
+		return current().GetRateLimit() == 7
+	}, 5*time.Second, 300*time.Millisecond)
+
+	// 后面的片段覆盖前面的片段
+	writeFile(t, dir+"/conf.d/20-rate.json", `{"rateLimit": 8}`)
+	assert.Eventually(t, func() bool { return current().GetRateLimit() == 8 }, 5*time.Second, 20*time.Millisecond)
+
+	// 删除片段后恢复为配置文件中的值
+	assert.NoError(t, os.Remove(dir+"/conf.d/20-rate.json"))
+	assert.NoError(t, os.Remove(dir+"/conf.d/10-rate.yaml"))
+	assert.Eventually(t, func() bool { return current().GetRateLimit() == 5000 }, 5*time.Second, 20*time.Millisecond)
+
+	// 无法加载的修改不替换当前配置
+	writeFile(t, dir+"/conf.d/30-bad.json", `{"httpPort": 0}`)
+	time.Sleep(2 * debounce)
+	assert.Equal(t, 5000, current().GetRateLimit())
+	assert.NotZero(t, current().GetHTTPPort())
+}
+
+func TestIsConfigEvent(t *testing.T) {
+	oldFile, oldDir := confFile, confDir
+	defer func() { confFile, confDir = oldFile, oldDir }()
+	confFile, confDir = "/etc/nodeid/app.json", ""
+
+	assert.True(t, isConfigEvent("/etc/nodeid/app.json"))
+	assert.True(t, isConfigEvent("/etc/nodeid/conf.d/10-port.YAML"))
+	assert.False(t, isConfigEvent("/etc/nodeid/conf.d/10-port.yaml.swp"))
+	assert.False(t, isConfigEvent("/etc/nodeid/other.json"))
+	assert.False(t, isConfigEvent("/etc/nodeid/conf.d/sub/10-port.json"))
+
+	confDir = "/run/nodeid"
+	assert.True(t, isConfigEvent("/run/nodeid/10-port.toml"))
+	assert.False(t, isConfigEvent("/etc/nodeid/conf.d/10-port.yaml"))
+}
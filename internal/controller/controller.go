@@ -6,10 +6,65 @@ import (
 
 type Controller interface {
 	GetNodeID(*gin.Context)
+	GetNodeIDV2(*gin.Context)
+	ReleaseNodeID(*gin.Context)
+	RenewNodeID(*gin.Context)
+	EvictNode(*gin.Context)
+	ReserveNode(*gin.Context)
+	ListNodes(*gin.Context)
+	NodeHistory(*gin.Context)
+	ListServices(*gin.Context)
+
+	ListRegistry(*gin.Context)
+	GetRegistry(*gin.Context)
+	CreateRegistry(*gin.Context)
+	UpdateRegistry(*gin.Context)
+	DeleteRegistry(*gin.Context)
+	QueryAudit(*gin.Context)
+	ExportSnapshot(*gin.Context)
+	ImportSnapshot(*gin.Context)
+	Liveness(*gin.Context)
+	Readiness(*gin.Context)
 }
 
 func RegisterHandler(engine *gin.Engine, ctrl Controller, debugMode bool) {
-	group1 := engine.Group("/named/v1")
+	engine.GET("/health/live", ctrl.Liveness)
+	engine.GET("/health/ready", ctrl.Readiness)
+
+	// 租户通过X-Tenant请求头指定, 或者使用/tenants/:tenant/下的路由; 配置了鉴权时以token中的租户为准
+	registerNamed(engine.Group("/"), ctrl)
+	registerAdmin(engine.Group("/"), ctrl)
+	tenant := engine.Group("/tenants/:tenant")
+	tenant.GET("/services", ctrl.ListServices)
+	registerNamed(tenant, ctrl)
+	registerAdmin(tenant, ctrl)
+}
+
+func registerAdmin(router *gin.RouterGroup, ctrl Controller) {
+	admin := router.Group("/admin/v1")
+	admin.GET("/services", ctrl.ListRegistry)
+	admin.POST("/services", ctrl.CreateRegistry)
+	admin.GET("/services/:serverName", ctrl.GetRegistry)
+	admin.PUT("/services/:serverName", ctrl.UpdateRegistry)
+	admin.DELETE("/services/:serverName", ctrl.DeleteRegistry)
+	admin.PUT("/services/:serverName/nodes/:id", ctrl.ReserveNode)
+	admin.DELETE("/services/:serverName/nodes/:id", ctrl.EvictNode)
+	admin.GET("/nodes", ctrl.ListServices)
+	admin.GET("/audit", ctrl.QueryAudit)
+	admin.GET("/snapshot", ctrl.ExportSnapshot)
+	admin.POST("/snapshot", ctrl.ImportSnapshot)
+}
+
+func registerNamed(router *gin.RouterGroup, ctrl Controller) {
+	group1 := router.Group("/named/v1")
 	group1.GET("/:serverName/nodeid", ctrl.GetNodeID)
 	group1.POST("/:serverName/nodeid", ctrl.GetNodeID)
+	group1.DELETE("/:serverName/nodeid", ctrl.ReleaseNodeID)
+	group1.PUT("/:serverName/nodes/:id", ctrl.RenewNodeID)
+	group1.GET("/:serverName/nodes", ctrl.ListNodes)
+	group1.GET("/:serverName/nodes/:id/history", ctrl.NodeHistory)
+
+	group2 := router.Group("/named/v2")
+	group2.GET("/:serverName/nodeid", ctrl.GetNodeIDV2)
+	group2.POST("/:serverName/nodeid", ctrl.GetNodeIDV2)
 }
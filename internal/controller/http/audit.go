@@ -0,0 +1,82 @@
+package http
+
+import (
+	"strconv"
+	"time"
+
+	"nodeid/internal/audit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const defaultAuditLimit = 100
+
+// QueryAudit 查询审计日志, 支持service、id、ip、from、to(RFC3339)和limit过滤.
+// 只返回请求所在租户的记录, 不带租户的/admin/v1/audit可以用allTenants=true查看所有租户
+func (c *ControllerOnHttp) QueryAudit(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	f, err := parseAuditFilter(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+	f.Tenant = tenant
+	if f.AllTenants {
+		if _, ok := ctx.Params.Get("tenant"); ok {
+			c.ResponseWithDesc(ctx, CodeInvalidParam, "allTenants is only allowed on /admin/v1/audit")
+			return
+		}
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	entries, err := c.useCase.QueryAudit(reqCtx, f)
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, gin.H{"entries": entries})
+}
+
+func parseAuditFilter(ctx *gin.Context) (f *audit.Filter, err error) {
+	f = &audit.Filter{
+		Service: ctx.Query("service"),
+		IP:      ctx.Query("ip"),
+		Limit:   defaultAuditLimit,
+	}
+
+	if s := ctx.Query("allTenants"); s != "" {
+		if f.AllTenants, err = strconv.ParseBool(s); err != nil {
+			return nil, errors.Errorf("invalid allTenants %q", s)
+		}
+	}
+	if s := ctx.Query("id"); s != "" {
+		if f.NodeID, err = strconv.Atoi(s); err != nil || f.NodeID <= 0 {
+			return nil, errors.Errorf("invalid id %q", s)
+		}
+	}
+	if s := ctx.Query("limit"); s != "" {
+		if f.Limit, err = strconv.Atoi(s); err != nil || f.Limit <= 0 {
+			return nil, errors.Errorf("invalid limit %q", s)
+		}
+	}
+	if s := ctx.Query("from"); s != "" {
+		if f.From, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, errors.Wrap(err, "invalid from")
+		}
+	}
+	if s := ctx.Query("to"); s != "" {
+		if f.To, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, errors.Wrap(err, "invalid to")
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdentityKey 鉴权通过后, 调用方的身份通过ctx.Set写入
+	IdentityKey = "identity"
+
+	bearerPrefix = "Bearer "
+)
+
+// Identity token对应的调用方. 非管理员只能访问Tenant(为空时为默认租户), 忽略X-Tenant请求头;
+// 管理员可以访问/admin下的接口, 通过请求头或路由指定租户
+type Identity struct {
+	Name   string
+	Tenant string
+	Admin  bool
+}
+
+// Authenticator 校验Authorization: Bearer <token>, 没有配置token时不鉴权.
+// token可以在运行时替换
+type Authenticator struct {
+	tokens atomic.Value // map[string]*Identity
+}
+
+// NewAuthenticator ...
+func NewAuthenticator(tokens map[string]*Identity) *Authenticator {
+	a := &Authenticator{}
+	a.Set(tokens)
+	return a
+}
+
+// Set 替换所有token
+func (a *Authenticator) Set(tokens map[string]*Identity) {
+	if tokens == nil {
+		tokens = map[string]*Identity{}
+	}
+	a.tokens.Store(tokens)
+}
+
+// Middleware 需要放在路由匹配之后执行的位置(engine.Use), 以便检查路由中的租户
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tokens := a.tokens.Load().(map[string]*Identity)
+		if len(tokens) == 0 || isPublic(ctx.Request.URL.Path) {
+			ctx.Next()
+			return
+		}
+
+		header := ctx.GetHeader("Authorization")
+		if !strings.HasPrefix(header, bearerPrefix) {
+			abortWithCode(ctx, CodeAccessToken)
+			return
+		}
+		id, ok := tokens[strings.TrimPrefix(header, bearerPrefix)]
+		if !ok {
+			abortWithCode(ctx, CodeVerifyToken)
+			return
+		}
+
+		if !id.Admin {
+			if strings.Contains(ctx.Request.URL.Path, "/admin/") {
+				abortWithCode(ctx, CodeIllegalToken)
+				return
+			}
+			if tenant, ok := ctx.Params.Get("tenant"); ok && tenant != id.Tenant {
+				abortWithCode(ctx, CodeIllegalToken)
+				return
+			}
+			ctx.Set(TenantKey, id.Tenant)
+		}
+		ctx.Set(IdentityKey, id)
+		ctx.Next()
+	}
+}
+
+// isPublic 健康检查和prometheus抓取的指标不需要token
+func isPublic(path string) bool {
+	return strings.HasPrefix(path, "/health") || path == "/metrics"
+}
+
+// abortWithCode v2接口返回problem+json, 其他接口返回错误码
+func abortWithCode(ctx *gin.Context, code int) {
+	c := &ControllerOnHttp{}
+	if strings.Contains(ctx.Request.URL.Path, "/named/v2") {
+		c.ResponseProblem(ctx, code, nil)
+	} else {
+		c.ResponseWithCode(ctx, code)
+	}
+	ctx.Abort()
+}
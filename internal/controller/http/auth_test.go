@@ -0,0 +1,87 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAuthRouter(tokens map[string]*Identity) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewAuthenticator(tokens).Middleware())
+	tenant := func(ctx *gin.Context) {
+		t, err := tenantOf(ctx)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx.String(http.StatusOK, t)
+	}
+	r.GET("/named/v1/:serverName/nodeid", tenant)
+	r.GET("/tenants/:tenant/named/v1/:serverName/nodeid", tenant)
+	r.GET("/admin/v1/services", tenant)
+	return r
+}
+
+func serve(r *gin.Engine, path, token, tenant string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if tenant != "" {
+		req.Header.Set(tenantHeader, tenant)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func errCode(t *testing.T, w *httptest.ResponseRecorder) int {
+	var resp Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.ErrCode
+}
+
+func errDesc(t *testing.T, w *httptest.ResponseRecorder) string {
+	var resp Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.ErrDesc
+}
+
+func TestAuthenticatorDisabled(t *testing.T) {
+	r := newAuthRouter(nil)
+	w := serve(r, "/named/v1/foo/nodeid", "", "shop")
+	assert.Equal(t, "shop", w.Body.String())
+}
+
+func TestAuthenticatorTenantClaim(t *testing.T) {
+	r := newAuthRouter(map[string]*Identity{
+		"t1":    {Name: "order", Tenant: "shop"},
+		"t2":    {Name: "default"},
+		"admin": {Name: "ops", Admin: true},
+	})
+
+	w := serve(r, "/named/v1/foo/nodeid", "", "")
+	assert.Equal(t, CodeAccessToken, errCode(t, w))
+	assert.Equal(t, "missing access token", errDesc(t, w))
+	w = serve(r, "/named/v1/foo/nodeid", "bad", "")
+	assert.Equal(t, CodeVerifyToken, errCode(t, w))
+	assert.Equal(t, "something wrong when verify token", errDesc(t, w))
+
+	// token中有租户时忽略请求头
+	assert.Equal(t, "shop", serve(r, "/named/v1/foo/nodeid", "t1", "other").Body.String())
+	assert.Equal(t, "", serve(r, "/named/v1/foo/nodeid", "t2", "shop").Body.String())
+	assert.Equal(t, "shop", serve(r, "/tenants/shop/named/v1/foo/nodeid", "t1", "").Body.String())
+	assert.Equal(t, CodeIllegalToken, errCode(t, serve(r, "/tenants/other/named/v1/foo/nodeid", "t1", "")))
+	w = serve(r, "/admin/v1/services", "t1", "")
+	assert.Equal(t, CodeIllegalToken, errCode(t, w))
+	assert.Equal(t, "illegal token", errDesc(t, w))
+
+	assert.Equal(t, "other", serve(r, "/named/v1/foo/nodeid", "admin", "other").Body.String())
+	assert.Equal(t, "shop", serve(r, "/admin/v1/services", "admin", "shop").Body.String())
+}
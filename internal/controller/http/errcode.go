@@ -1,5 +1,14 @@
 package http
 
+import (
+	"context"
+
+	"nodeid/internal/service"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+)
+
 var codeText map[int]string
 
 const (
@@ -10,6 +19,16 @@ const (
 	CodeVerifyToken                // 验证access token 出错
 	CodeIllegalToken               // 非法token
 	CodeNodeID                     // 获取 node id 失败
+	CodeTimeout                    // 请求超时或被取消
+	CodeNotFound                   // 资源不存在
+	CodeRateLimited                // 请求过于频繁
+	CodeConflict                   // 与其他请求冲突, 重试次数用尽
+	CodeExhausted                  // 没有可分配的 node id
+	CodeBackend                    // 存储后端不可用
+	CodeCorrupted                  // 存储中的记录已损坏
+	CodeIdempotency                // 幂等key已被其他调用方使用
+	CodeQuota                      // 超出配额
+	CodeUnregistered               // 服务未注册
 )
 
 func init() {
@@ -17,7 +36,50 @@ func init() {
 	codeText[CodeSuccess] = "success"
 	codeText[CodeLackParam] = "lack of param"
 	codeText[CodeInvalidParam] = "invalid param"
+	codeText[CodeAccessToken] = "missing access token"
 	codeText[CodeVerifyToken] = "something wrong when verify token"
 	codeText[CodeIllegalToken] = "illegal token"
 	codeText[CodeNodeID] = "failed to get node id"
+	codeText[CodeTimeout] = "request timeout or canceled"
+	codeText[CodeNotFound] = "not found"
+	codeText[CodeRateLimited] = "too many requests"
+	codeText[CodeConflict] = "conflict with other holders"
+	codeText[CodeExhausted] = "no available node id"
+	codeText[CodeBackend] = "backend unavailable"
+	codeText[CodeCorrupted] = "corrupted record"
+	codeText[CodeIdempotency] = "idempotency key used by another holder"
+	codeText[CodeQuota] = "quota exceeded"
+	codeText[CodeUnregistered] = "service not registered"
+}
+
+// codeOfError 把service层返回的错误转换为错误码
+func codeOfError(err error) int {
+	switch {
+	case err == nil:
+		return CodeSuccess
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return CodeTimeout
+	case errors.Is(err, nid.ErrConflict):
+		return CodeConflict
+	case errors.Is(err, nid.ErrExhausted):
+		return CodeExhausted
+	case errors.Is(err, nid.ErrBackendUnavailable):
+		return CodeBackend
+	case errors.Is(err, nid.ErrCorrupted):
+		return CodeCorrupted
+	case errors.Is(err, nid.ErrIdempotencyMismatch):
+		return CodeIdempotency
+	case errors.Is(err, service.ErrQuotaExceeded):
+		return CodeQuota
+	case errors.Is(err, service.ErrUnregistered):
+		return CodeUnregistered
+	case errors.Is(err, service.ErrAuditDisabled):
+		return CodeNotFound
+	case errors.Is(err, service.ErrInvalidService), errors.Is(err, service.ErrInvalidSnapshot),
+		errors.Is(err, service.ErrInvalidName), errors.Is(err, nid.ErrOutOfRange):
+		return CodeInvalidParam
+	case errors.Is(err, nid.ErrNotFound):
+		return CodeNotFound
+	}
+	return CodeNodeID
 }
@@ -0,0 +1,30 @@
+package http
+
+import (
+	"context"
+	"testing"
+
+	"nodeid/internal/service"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeOfError(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{nil, CodeSuccess},
+		{errors.Wrap(context.DeadlineExceeded, "get"), CodeTimeout},
+		{errors.Wrap(nid.ErrExhausted, "apply"), CodeExhausted},
+		{errors.Wrap(nid.ErrBackendUnavailable, "list"), CodeBackend},
+		{errors.Wrap(nid.ErrNotFound, "renew"), CodeNotFound},
+		{errors.Wrap(service.ErrQuotaExceeded, "foo"), CodeQuota},
+		{errors.New("other"), CodeNodeID},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.code, codeOfError(c.err), "%v", c.err)
+	}
+}
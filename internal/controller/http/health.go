@@ -0,0 +1,60 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 就绪检查访问后端的最长时间
+const probeTimeout = time.Second
+
+const (
+	statusUp   = "up"
+	statusDown = "down"
+)
+
+type dependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status       string                       `json:"status"`
+	Dependencies map[string]*dependencyStatus `json:"dependencies,omitempty"`
+}
+
+// Liveness 进程存活即返回成功
+func (c *ControllerOnHttp) Liveness(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, &healthResponse{Status: statusUp})
+}
+
+// Readiness 检查kv后端是否可用, 不可用时返回503
+func (c *ControllerOnHttp) Readiness(ctx *gin.Context) {
+	probeCtx, cancel := context.WithTimeout(ctx.Request.Context(), probeTimeout)
+	defer cancel()
+
+	begin := time.Now()
+	err := c.useCase.Ping(probeCtx)
+	kv := &dependencyStatus{
+		Status:    statusUp,
+		LatencyMs: float64(time.Since(begin).Microseconds()) / 1000,
+	}
+
+	resp := &healthResponse{
+		Status:       statusUp,
+		Dependencies: map[string]*dependencyStatus{"kv": kv},
+	}
+	code := http.StatusOK
+	if err != nil {
+		kv.Status = statusDown
+		kv.Error = err.Error()
+		resp.Status = statusDown
+		code = http.StatusServiceUnavailable
+	}
+
+	ctx.JSON(code, resp)
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nodeid/internal/service"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// pingUseCase 只替换Ping, 模拟后端不可用
+type pingUseCase struct {
+	service.UseCase
+	err error
+}
+
+func (u *pingUseCase) Ping(context.Context) error {
+	return u.err
+}
+
+func TestReadiness(t *testing.T) {
+	uc := &pingUseCase{UseCase: newTestUseCase(t)}
+	r := newRouter(uc)
+
+	health := func(w *httptest.ResponseRecorder) *healthResponse {
+		resp := &healthResponse{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		return resp
+	}
+
+	w := do(r, http.MethodGet, "/health/ready", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, statusUp, health(w).Dependencies["kv"].Status)
+
+	uc.err = errors.New("connection refused")
+	w = do(r, http.MethodGet, "/health/ready", "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	resp := health(w)
+	assert.Equal(t, statusDown, resp.Status)
+	assert.Equal(t, "connection refused", resp.Dependencies["kv"].Error)
+
+	// 存活检查不访问后端
+	assert.Equal(t, http.StatusOK, do(r, http.MethodGet, "/health/live", "").Code)
+}
@@ -2,10 +2,12 @@ package http
 
 import (
 	"net/http"
+	"time"
 
 	"nodeid/internal/controller"
 	"nodeid/internal/service"
 	"nodeid/pkg/log"
+	"nodeid/pkg/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,18 +18,21 @@ type Response struct {
 	ErrDesc string `json:"errDesc"`
 }
 
-func NewHttpController(uc service.UseCase) controller.Controller {
+func NewHttpController(uc service.UseCase, timeout time.Duration) controller.Controller {
 	return &ControllerOnHttp{
 		useCase: uc,
+		timeout: timeout,
 	}
 }
 
 type ControllerOnHttp struct {
 	useCase service.UseCase
+	timeout time.Duration
 }
 
 // ResponseWithData ...
 func (c *ControllerOnHttp) ResponseWithData(ctx *gin.Context, data interface{}) {
+	ctx.Set(middleware.ErrCodeKey, CodeSuccess)
 	ctx.JSON(http.StatusOK, gin.H{"errCode": 0, "errDesc": "success", "data": data})
 }
 
@@ -41,6 +46,7 @@ func (c *ControllerOnHttp) ResponseWithCode(ctx *gin.Context, code int) {
 		resp.ErrDesc = "unknown codeText"
 	}
 
+	ctx.Set(middleware.ErrCodeKey, code)
 	ctx.JSON(http.StatusOK, resp)
 	if code != CodeSuccess {
 		c.ErrorLog(ctx, resp)
@@ -54,6 +60,7 @@ func (c *ControllerOnHttp) ResponseWithDesc(ctx *gin.Context, code int, desc str
 		ErrDesc: desc,
 	}
 
+	ctx.Set(middleware.ErrCodeKey, code)
 	ctx.JSON(http.StatusOK, resp)
 	if code != CodeSuccess {
 		c.ErrorLog(ctx, resp)
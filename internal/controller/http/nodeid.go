@@ -1,48 +1,178 @@
 package http
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"time"
+
+	"nodeid/internal/audit"
+	"nodeid/internal/store"
+	"nodeid/pkg/middleware"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	idempotencyHeader    = "Idempotency-Key"
+	actorHeader          = "X-Actor"
+	maxIdempotencyKeyLen = 128
 )
 
 type nodeRequest struct {
-	LocalPath  string `json:"path"`
-	InternalIP string `json:"ip"`
+	LocalPath      string `json:"path"`
+	InternalIP     string `json:"ip"`
+	IdempotencyKey string `json:"idempotencyKey"`
 }
 
+// GetNodeID v1接口, 总是返回200, 结果体现在errCode中
 func (c *ControllerOnHttp) GetNodeID(ctx *gin.Context) {
+	id, code, err := c.allocate(ctx)
+	switch code {
+	case CodeSuccess:
+		c.ResponseWithData(ctx, gin.H{"nodeId": id})
+	case CodeLackParam, CodeInvalidParam, CodeTimeout:
+		c.ResponseWithCode(ctx, code)
+	default:
+		c.ResponseWithDesc(ctx, code, err.Error())
+	}
+}
+
+// GetNodeIDV2 v2接口, 使用http状态码和problem+json描述错误
+func (c *ControllerOnHttp) GetNodeIDV2(ctx *gin.Context) {
+	id, code, err := c.allocate(ctx)
+	if code != CodeSuccess {
+		c.ResponseProblem(ctx, code, err)
+		return
+	}
+
+	ctx.Set(middleware.ErrCodeKey, CodeSuccess)
+	ctx.JSON(http.StatusOK, gin.H{"nodeId": id})
+}
+
+// allocate 解析请求参数并申请node id, 返回的code用于区分错误类型
+func (c *ControllerOnHttp) allocate(ctx *gin.Context) (int, int, error) {
+	req, code, err := parseNodeRequest(ctx)
+	if code != CodeSuccess {
+		return 0, code, err
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	id, err := c.useCase.GetNodeID(reqCtx, req)
+	return id, codeOfError(err), err
+}
+
+// ReleaseNodeID 释放调用方持有的node id
+func (c *ControllerOnHttp) ReleaseNodeID(ctx *gin.Context) {
+	req, code, err := parseNodeRequest(ctx)
+	if code != CodeSuccess {
+		c.ResponseWithCode(ctx, code)
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	id, err := c.useCase.ReleaseNodeID(reqCtx, req)
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, gin.H{"nodeId": id})
+}
+
+// RenewNodeID 续约调用方持有的node id, 不产生recovered事件, 返回服务的租约时长(秒).
+// 编号已被释放或收回时返回CodeNotFound, 需要重新申请
+func (c *ControllerOnHttp) RenewNodeID(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id <= 0 {
+		c.ResponseWithCode(ctx, CodeInvalidParam)
+		return
+	}
+
+	req, code, err := parseNodeRequest(ctx)
+	if code != CodeSuccess {
+		c.ResponseWithCode(ctx, code)
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	ttl, err := c.useCase.RenewNodeID(reqCtx, req, id)
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, gin.H{"nodeId": id, "leaseTtl": int(ttl / time.Second)})
+}
+
+// parseNodeRequest GET和DELETE从query中获取参数, POST和PUT从body中获取
+func parseNodeRequest(ctx *gin.Context) (*store.NodeRequest, int, error) {
 	service := ctx.Param("serverName")
 	if service == "" {
-		c.ResponseWithCode(ctx, CodeLackParam)
-		return
+		return nil, CodeLackParam, nil
 	}
 
-	var internalIp, localPath string
-	if ctx.Request.Method == http.MethodGet {
-		localPath = ctx.Query("path")
-		internalIp = ctx.Query("ip")
-	} else if ctx.Request.Method == http.MethodPost {
+	var internalIp, localPath, idempotencyKey string
+	if ctx.Request.Method == http.MethodPost || ctx.Request.Method == http.MethodPut {
 		req := &nodeRequest{}
 		err := ctx.ShouldBind(req)
 		if err != nil {
-			c.ResponseWithCode(ctx, CodeInvalidParam)
-			return
+			return nil, CodeInvalidParam, err
 		}
 		localPath = req.LocalPath
 		internalIp = req.InternalIP
+		idempotencyKey = req.IdempotencyKey
+	} else {
+		localPath = ctx.Query("path")
+		internalIp = ctx.Query("ip")
+		idempotencyKey = ctx.Query("idempotencyKey")
+	}
+	if key := ctx.GetHeader(idempotencyHeader); key != "" {
+		idempotencyKey = key
 	}
 
 	if internalIp == "" {
-		c.ResponseWithCode(ctx, CodeLackParam)
-		return
+		return nil, CodeLackParam, nil
 	}
 
-	id, err := c.useCase.GetNodeID(localPath, internalIp, service)
+	if !store.ValidName(idempotencyKey, maxIdempotencyKeyLen) {
+		return nil, CodeInvalidParam, errors.New("invalid idempotency key")
+	}
+
+	tenant, err := tenantOf(ctx)
 	if err != nil {
-		c.ResponseWithDesc(ctx, CodeNodeID, err.Error())
-		return
+		return nil, CodeInvalidParam, err
 	}
 
-	c.ResponseWithData(ctx, gin.H{"nodeId": id})
+	return &store.NodeRequest{
+		Tenant:         tenant,
+		Service:        service,
+		Path:           localPath,
+		Addr:           internalIp,
+		IdempotencyKey: idempotencyKey,
+	}, CodeSuccess, nil
+}
+
+// requestContext 为后端调用加上请求超时, 并记录操作者供审计使用
+func (c *ControllerOnHttp) requestContext(ctx *gin.Context) (context.Context, context.CancelFunc) {
+	reqCtx := audit.WithActor(ctx.Request.Context(), actorOf(ctx), ctx.GetHeader(actorHeader))
+	if c.timeout > 0 {
+		return context.WithTimeout(reqCtx, c.timeout)
+	}
+	return context.WithCancel(reqCtx)
+}
+
+// actorOf 操作者取token对应的身份, 未开启鉴权时使用客户端ip. X-Actor请求头只作为声明的操作者另外记录
+func actorOf(ctx *gin.Context) string {
+	if v, ok := ctx.Get(IdentityKey); ok {
+		return v.(*Identity).Name
+	}
+	return ctx.ClientIP()
 }
@@ -0,0 +1,187 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"nodeid/internal/controller"
+	"nodeid/internal/service"
+	"nodeid/internal/store"
+	"nodeid/pkg/middleware"
+	"nodeid/pkg/nid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestUseCase(t *testing.T) service.UseCase {
+	named, err := nid.NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoError(t, err)
+	return service.NewUseCase(store.NewDao(named))
+}
+
+// newRouter 与app中的中间件顺序一致
+func newRouter(uc service.UseCase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.NewMetrics(), middleware.NewTracing(), ProblemOnAbort("/named/v2"))
+	controller.RegisterHandler(r, NewHttpController(uc, 0), false)
+	return r
+}
+
+func do(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type dataResponse struct {
+	ErrCode int `json:"errCode"`
+	Data    struct {
+		NodeID   int `json:"nodeId"`
+		LeaseTTL int `json:"leaseTtl"`
+	} `json:"data"`
+}
+
+func decodeData(t *testing.T, w *httptest.ResponseRecorder) *dataResponse {
+	resp := &dataResponse{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+	return resp
+}
+
+func TestNodeIDV1(t *testing.T) {
+	r := newRouter(newTestUseCase(t))
+
+	w := do(r, http.MethodGet, "/named/v1/foo/nodeid?ip=127.0.0.1&path=/app", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := decodeData(t, w)
+	assert.Equal(t, CodeSuccess, resp.ErrCode)
+	id := resp.Data.NodeID
+	assert.NotZero(t, id)
+
+	// v1的错误也返回200
+	w = do(r, http.MethodGet, "/named/v1/foo/nodeid?path=/app", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, CodeLackParam, errCode(t, w))
+
+	w = do(r, http.MethodDelete, "/named/v1/foo/nodeid?ip=127.0.0.1&path=/app", "")
+	assert.Equal(t, id, decodeData(t, w).Data.NodeID)
+}
+
+func TestCanceledRequest(t *testing.T) {
+	r := newRouter(newTestUseCase(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// 调用方断开后不再访问后端, 按超时返回
+	serveCanceled := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path+"?ip=127.0.0.1&path=/app", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, CodeTimeout, errCode(t, serveCanceled("/named/v1/foo/nodeid")))
+	w := serveCanceled("/named/v2/foo/nodeid")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"timeout"`)
+}
+
+func TestRenewNodeID(t *testing.T) {
+	uc := newTestUseCase(t)
+	r := newRouter(uc)
+	body := `{"ip":"127.0.0.1","path":"/app"}`
+
+	id := decodeData(t, do(r, http.MethodPost, "/named/v1/foo/nodeid", body)).Data.NodeID
+	path := "/named/v1/foo/nodes/" + strconv.Itoa(id)
+
+	resp := decodeData(t, do(r, http.MethodPut, path, body))
+	assert.Equal(t, CodeSuccess, resp.ErrCode)
+	assert.Equal(t, id, resp.Data.NodeID)
+
+	// 其他持有者和无效编号
+	assert.Equal(t, CodeNotFound, errCode(t, do(r, http.MethodPut, path, `{"ip":"127.0.0.2","path":"/app"}`)))
+	assert.Equal(t, CodeInvalidParam, errCode(t, do(r, http.MethodPut, "/named/v1/foo/nodes/x", body)))
+
+	do(r, http.MethodDelete, "/named/v1/foo/nodeid?ip=127.0.0.1&path=/app", "")
+	assert.Equal(t, CodeNotFound, errCode(t, do(r, http.MethodPut, path, body)))
+}
+
+func TestMetrics(t *testing.T) {
+	r := newRouter(newTestUseCase(t))
+	route := "/named/v1/:serverName/nodeid"
+	count := func(status, code string) float64 {
+		c, err := prometheus.DefaultGatherer.Gather()
+		assert.NoError(t, err)
+		for _, mf := range c {
+			if mf.GetName() != "nodeid_http_requests_total" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				labels := map[string]string{}
+				for _, l := range m.GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+				if labels["route"] == route && labels["method"] == http.MethodGet &&
+					labels["status"] == status && labels["code"] == code {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+
+	ok, lack := count("200", "0"), count("200", strconv.Itoa(CodeLackParam))
+	do(r, http.MethodGet, "/named/v1/foo/nodeid?ip=127.0.0.1&path=/app", "")
+	do(r, http.MethodGet, "/named/v1/foo/nodeid?path=/app", "")
+	assert.Equal(t, ok+1, count("200", "0"))
+	assert.Equal(t, lack+1, count("200", strconv.Itoa(CodeLackParam)))
+
+	// 后端调用的指标
+	n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "nodeid_backend_call_duration_seconds")
+	assert.NoError(t, err)
+	assert.NotZero(t, n)
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(prev)
+
+	r := newRouter(newTestUseCase(t))
+	do(r, http.MethodGet, "/named/v1/foo/nodeid?ip=127.0.0.1&path=/app", "")
+
+	// nid和存储调用的span与请求span在同一个trace中
+	spans := recorder.Ended()
+	var root sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.Name() == "GET /named/v1/:serverName/nodeid" {
+			root = s
+		}
+	}
+	if !assert.NotNil(t, root) {
+		return
+	}
+	names := map[string]bool{}
+	for _, s := range spans {
+		assert.Equal(t, root.SpanContext().TraceID(), s.SpanContext().TraceID())
+		names[s.Name()] = true
+	}
+	assert.True(t, names["nid.GetNodeID"])
+	assert.True(t, names["store.list"] && names["store.atomic_put"], "spans: %v", names)
+}
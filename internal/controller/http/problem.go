@@ -0,0 +1,109 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"nodeid/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:nodeid:problem:"
+)
+
+// Problem RFC 7807 错误描述
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+type problemType struct {
+	status int
+	code   string // 稳定的错误标识, 客户端依赖此值, 不要修改
+}
+
+var problemTypes = map[int]problemType{
+	CodeLackParam:    {http.StatusBadRequest, "missing_parameter"},
+	CodeInvalidParam: {http.StatusBadRequest, "invalid_parameter"},
+	CodeAccessToken:  {http.StatusUnauthorized, "access_token_unavailable"},
+	CodeVerifyToken:  {http.StatusUnauthorized, "token_verification_failed"},
+	CodeIllegalToken: {http.StatusForbidden, "illegal_token"},
+	CodeNodeID:       {http.StatusInternalServerError, "allocation_failed"},
+	CodeTimeout:      {http.StatusServiceUnavailable, "timeout"},
+	CodeNotFound:     {http.StatusNotFound, "not_found"},
+	CodeRateLimited:  {http.StatusTooManyRequests, "rate_limited"},
+	CodeConflict:     {http.StatusConflict, "conflict"},
+	CodeExhausted:    {http.StatusConflict, "node_id_exhausted"},
+	CodeBackend:      {http.StatusServiceUnavailable, "backend_unavailable"},
+	CodeCorrupted:    {http.StatusInternalServerError, "corrupted_record"},
+	CodeIdempotency:  {http.StatusUnprocessableEntity, "idempotency_key_mismatch"},
+	CodeQuota:        {http.StatusTooManyRequests, "quota_exceeded"},
+	CodeUnregistered: {http.StatusNotFound, "service_not_registered"},
+}
+
+// ResponseProblem 以problem+json返回错误, err不为空时作为detail
+func (c *ControllerOnHttp) ResponseProblem(ctx *gin.Context, code int, err error) {
+	pt, ok := problemTypes[code]
+	if !ok {
+		pt = problemType{http.StatusInternalServerError, "internal_error"}
+	}
+
+	detail := codeText[code]
+	if err != nil {
+		detail = err.Error()
+	}
+
+	p := newProblem(ctx, pt, detail)
+	ctx.Set(middleware.ErrCodeKey, code)
+	writeProblem(ctx, p)
+	c.ErrorLog(ctx, &Response{ErrCode: code, ErrDesc: detail})
+}
+
+// ProblemOnAbort 为路径包含prefix且被中间件中止或未匹配路由、未写入body的请求补充problem+json,
+// 需要放在限流等中间件之前
+func ProblemOnAbort(prefix string) gin.HandlerFunc {
+	byStatus := map[int]problemType{
+		http.StatusNotFound:        problemTypes[CodeNotFound],
+		http.StatusTooManyRequests: problemTypes[CodeRateLimited],
+	}
+
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		if ctx.Writer.Written() || status < http.StatusBadRequest ||
+			!strings.Contains(ctx.Request.URL.Path, prefix) {
+			return
+		}
+
+		pt, ok := byStatus[status]
+		if !ok {
+			pt = problemType{status, strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))}
+		}
+		writeProblem(ctx, newProblem(ctx, pt, ""))
+	}
+}
+
+func newProblem(ctx *gin.Context, pt problemType, detail string) *Problem {
+	return &Problem{
+		Type:     problemTypePrefix + pt.code,
+		Title:    http.StatusText(pt.status),
+		Status:   pt.status,
+		Detail:   detail,
+		Instance: ctx.Request.URL.Path,
+		Code:     pt.code,
+	}
+}
+
+func writeProblem(ctx *gin.Context, p *Problem) {
+	ctx.Header("Content-Type", problemContentType)
+	ctx.Render(p.Status, render.JSON{Data: p})
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeIDV2(t *testing.T) {
+	r := newRouter(newTestUseCase(t))
+
+	w := do(r, http.MethodGet, "/named/v2/foo/nodeid?ip=127.0.0.1&path=/app", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	problem := func(w *httptest.ResponseRecorder) *Problem {
+		assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+		p := &Problem{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), p))
+		assert.Equal(t, w.Code, p.Status)
+		return p
+	}
+
+	w = do(r, http.MethodGet, "/named/v2/foo/nodeid?path=/app", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	p := problem(w)
+	assert.Equal(t, "missing_parameter", p.Code)
+	assert.Equal(t, problemTypePrefix+"missing_parameter", p.Type)
+	assert.Equal(t, "/named/v2/foo/nodeid", p.Instance)
+
+	// 未匹配的路由也返回problem+json
+	w = do(r, http.MethodGet, "/named/v2/foo/unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "not_found", problem(w).Code)
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"strconv"
+
+	"nodeid/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// ListRegistry 列出租户下已注册的服务
+func (c *ControllerOnHttp) ListRegistry(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	infos, err := c.useCase.ListRegistry(reqCtx, tenant)
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, gin.H{"tenant": tenant, "services": infos})
+}
+
+// GetRegistry 查询服务的注册信息
+func (c *ControllerOnHttp) GetRegistry(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	info, err := c.useCase.GetService(reqCtx, tenant, ctx.Param("serverName"))
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, info)
+}
+
+// CreateRegistry 注册服务, 已存在时返回冲突
+func (c *ControllerOnHttp) CreateRegistry(ctx *gin.Context) {
+	c.saveRegistry(ctx, true)
+}
+
+// UpdateRegistry 修改已注册服务的信息
+func (c *ControllerOnHttp) UpdateRegistry(ctx *gin.Context) {
+	c.saveRegistry(ctx, false)
+}
+
+func (c *ControllerOnHttp) saveRegistry(ctx *gin.Context, create bool) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	info := &store.ServiceInfo{}
+	if err := ctx.ShouldBindJSON(info); err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+	if name := ctx.Param("serverName"); name != "" {
+		if info.Name != "" && info.Name != name {
+			c.ResponseWithDesc(ctx, CodeInvalidParam, errors.Errorf("name %q does not match %q", info.Name, name).Error())
+			return
+		}
+		info.Name = name
+	}
+	if !store.ValidName(info.Name, store.MaxServiceLen) {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, errors.Errorf("invalid service name %q", info.Name).Error())
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	if create {
+		err = c.useCase.CreateService(reqCtx, tenant, info)
+	} else {
+		err = c.useCase.UpdateService(reqCtx, tenant, info)
+	}
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, info)
+}
+
+// DeleteRegistry 删除服务的注册信息, 已分配的编号不受影响
+func (c *ControllerOnHttp) DeleteRegistry(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	if err := c.useCase.DeleteService(reqCtx, tenant, ctx.Param("serverName")); err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithCode(ctx, CodeSuccess)
+}
+
+// EvictNode 收回服务的某个编号, 不管持有者是谁
+func (c *ControllerOnHttp) EvictNode(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id <= 0 {
+		c.ResponseWithCode(ctx, CodeInvalidParam)
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	previous, err := c.useCase.EvictNodeID(reqCtx, tenant, ctx.Param("serverName"), id)
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, gin.H{"nodeId": id, "previous": previous})
+}
+
+// ReserveNode 为调用方占用指定的编号, 编号已被占用时返回冲突
+func (c *ControllerOnHttp) ReserveNode(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id <= 0 {
+		c.ResponseWithCode(ctx, CodeInvalidParam)
+		return
+	}
+
+	req, code, err := parseNodeRequest(ctx)
+	if code != CodeSuccess {
+		c.ResponseWithCode(ctx, code)
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	if err := c.useCase.ReserveNodeID(reqCtx, req, id); err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, gin.H{"nodeId": id})
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"net/http"
+
+	"nodeid/pkg/middleware"
+	"nodeid/pkg/nid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// ExportSnapshot 导出租户下所有的编号记录, format为json(默认)或ndjson
+func (c *ControllerOnHttp) ExportSnapshot(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	format := ctx.DefaultQuery("format", "json")
+	if format != "json" && format != "ndjson" {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, errors.Errorf("unknown format %q", format).Error())
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	snap, err := c.useCase.Export(reqCtx, tenant)
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	contentType := "application/json"
+	if format == "ndjson" {
+		contentType = "application/x-ndjson"
+	}
+	ctx.Set(middleware.ErrCodeKey, CodeSuccess)
+	ctx.Header("Content-Type", contentType)
+	ctx.Status(http.StatusOK)
+	_ = nid.WriteSnapshot(ctx.Writer, snap, format == "ndjson")
+}
+
+// ImportSnapshot 导入json或ndjson格式的快照, conflict指定记录已存在时的处理方式, 默认跳过
+func (c *ControllerOnHttp) ImportSnapshot(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	policy := ctx.DefaultQuery("conflict", nid.ConflictSkip)
+	switch policy {
+	case nid.ConflictSkip, nid.ConflictOverwrite, nid.ConflictFail:
+	default:
+		c.ResponseWithDesc(ctx, CodeInvalidParam, errors.Errorf("unknown conflict policy %q", policy).Error())
+		return
+	}
+
+	snap, err := nid.ReadSnapshot(ctx.Request.Body)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	result, err := c.useCase.Import(reqCtx, tenant, snap, policy)
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, result)
+}
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"strconv"
+
+	"nodeid/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// TenantKey 鉴权中间件从token中解析出租户后, 通过ctx.Set写入
+	TenantKey = "tenant"
+
+	tenantHeader = "X-Tenant"
+)
+
+// tenantOf token中有租户时只使用token中的租户, 否则依次从路由、请求头中获取, 都为空时使用默认空间
+func tenantOf(ctx *gin.Context) (string, error) {
+	if claim, ok := ctx.Get(TenantKey); ok {
+		tenant, _ := claim.(string)
+		return tenant, nil
+	}
+
+	tenant := ctx.Param("tenant")
+	if tenant == "" {
+		tenant = ctx.GetHeader(tenantHeader)
+	}
+
+	if !store.ValidName(tenant, store.MaxTenantLen) {
+		return "", errors.Errorf("invalid tenant %q", tenant)
+	}
+	return tenant, nil
+}
+
+// ListServices 列出租户下的服务及占用的编号数
+func (c *ControllerOnHttp) ListServices(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	services, err := c.useCase.Services(reqCtx, tenant)
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, gin.H{"tenant": tenant, "services": services})
+}
+
+// ListNodes 列出服务下被占用的编号及持有者
+func (c *ControllerOnHttp) ListNodes(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	nodes, err := c.useCase.Nodes(reqCtx, tenant, ctx.Param("serverName"))
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, gin.H{"tenant": tenant, "nodes": nodes})
+}
+
+// NodeHistory 查询编号最近的持有者
+func (c *ControllerOnHttp) NodeHistory(ctx *gin.Context) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		c.ResponseWithDesc(ctx, CodeInvalidParam, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil || id <= 0 {
+		c.ResponseWithCode(ctx, CodeInvalidParam)
+		return
+	}
+
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	owners, err := c.useCase.History(reqCtx, tenant, ctx.Param("serverName"), id)
+	if err != nil {
+		c.ResponseWithDesc(ctx, codeOfError(err), err.Error())
+		return
+	}
+
+	c.ResponseWithData(ctx, gin.H{"tenant": tenant, "nodeId": id, "history": owners})
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	r := newRouter(newTestUseCase(t))
+	query := "?ip=127.0.0.1&path=/app"
+
+	id := decodeData(t, do(r, http.MethodGet, "/named/v1/foo/nodeid"+query, "")).Data.NodeID
+	shop := decodeData(t, do(r, http.MethodGet, "/tenants/shop/named/v1/foo/nodeid"+query, "")).Data.NodeID
+	assert.NotZero(t, shop)
+	// 每个租户单独分配编号
+	other := decodeData(t, do(r, http.MethodGet, "/tenants/shop/named/v1/foo/nodeid?ip=127.0.0.2&path=/app", "")).Data.NodeID
+	assert.NotEqual(t, shop, other)
+
+	services := func(w *httptest.ResponseRecorder) map[string]int {
+		var resp struct {
+			Data struct {
+				Services map[string]int `json:"services"`
+			} `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data.Services
+	}
+	assert.Equal(t, map[string]int{"foo": 2}, services(do(r, http.MethodGet, "/tenants/shop/services", "")))
+	assert.Equal(t, map[string]int{"foo": 1}, services(do(r, http.MethodGet, "/admin/v1/nodes", "")))
+
+	// 请求头与路由中的租户等价
+	req := httptest.NewRequest(http.MethodGet, "/named/v1/foo/nodeid"+query, nil)
+	req.Header.Set(tenantHeader, "shop")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, shop, decodeData(t, w).Data.NodeID)
+
+	// 默认空间的编号不受影响
+	w = do(r, http.MethodDelete, "/named/v1/foo/nodeid"+query, "")
+	assert.Equal(t, id, decodeData(t, w).Data.NodeID)
+	assert.Equal(t, map[string]int{"foo": 2}, services(do(r, http.MethodGet, "/tenants/shop/services", "")))
+
+	assert.Equal(t, CodeInvalidParam, errCode(t, do(r, http.MethodGet, "/tenants/a%20b/named/v1/foo/nodeid"+query, "")))
+}
@@ -0,0 +1,29 @@
+package service
+
+import "nodeid/internal/audit"
+
+// Option ...
+type Option func(*useCaseImpl)
+
+// WithQuota 同时持有编号数的上限
+func WithQuota(q *Quota) Option {
+	return func(c *useCaseImpl) {
+		if q != nil {
+			c.update(func(s *settings) { s.quota = q })
+		}
+	}
+}
+
+// RequireRegistration 为true时拒绝为未注册的服务分配编号
+func RequireRegistration(require bool) Option {
+	return func(c *useCaseImpl) {
+		c.update(func(s *settings) { s.requireRegistration = require })
+	}
+}
+
+// WithAudit 记录服务注册信息的变更, 不支持Reconfigure
+func WithAudit(r *audit.Recorder) Option {
+	return func(c *useCaseImpl) {
+		c.audit = r
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrQuotaExceeded 服务或租户占用的编号数达到上限
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+var quotaRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "nodeid",
+	Name:      "quota_rejections_total",
+	Help:      "Number of allocations rejected for quota.",
+}, []string{"tenant", "service", "scope"})
+
+func init() {
+	prometheus.MustRegister(quotaRejections)
+}
+
+// Quota 同时持有编号的上限, 0表示不限制
+type Quota struct {
+	Service  int            // 每个服务的默认上限
+	Tenant   int            // 每个租户的默认上限
+	Services map[string]int // 单独设置的服务上限, key为服务名, 非默认租户为tenant/service
+	Tenants  map[string]int // 单独设置的租户上限
+}
+
+func (q *Quota) serviceLimit(tenant, service string) int {
+	name := service
+	if tenant != "" {
+		name = tenant + "/" + service
+	}
+	if n, ok := q.Services[name]; ok {
+		return n
+	}
+	return q.Service
+}
+
+func (q *Quota) tenantLimit(tenant string) int {
+	if n, ok := q.Tenants[tenant]; ok {
+		return n
+	}
+	return q.Tenant
+}
+
+// admit 返回申请新编号前检查配额的函数, held为服务中其他持有者占用的未过期编号数.
+// 服务和租户都只计算未过期的编号, 写入后nid会再检查一次
+func (c *useCaseImpl) admit(tenant, service string) func(context.Context, int) error {
+	quota := c.current().quota
+	return func(ctx context.Context, held int) error {
+		if limit := quota.serviceLimit(tenant, service); limit > 0 && held >= limit {
+			quotaRejections.WithLabelValues(tenant, service, "service").Inc()
+			return errors.Wrapf(ErrQuotaExceeded, "service %s holds %d of %d", service, held, limit)
+		}
+
+		limit := quota.tenantLimit(tenant)
+		if limit <= 0 {
+			return nil
+		}
+
+		services, err := c.dao.LiveServices(ctx, tenant)
+		if err != nil {
+			return err
+		}
+		total := held
+		for name, n := range services {
+			if name != service {
+				total += n
+			}
+		}
+		if total >= limit {
+			quotaRejections.WithLabelValues(tenant, service, "tenant").Inc()
+			return errors.Wrapf(ErrQuotaExceeded, "tenant %q holds %d of %d", tenant, total, limit)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestUseCase(t *testing.T, opts ...Option) (UseCase, nid.NodeNamed) {
+	named, err := nid.NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoError(t, err)
+	return NewUseCase(store.NewDao(named), opts...), named
+}
+
+func request(tenant, service string, i int) *store.NodeRequest {
+	return &store.NodeRequest{Tenant: tenant, Service: service, Addr: "127.0.0.1", Path: fmt.Sprintf("/app/%d", i)}
+}
+
+func TestQuotaService(t *testing.T) {
+	uc, _ := newTestUseCase(t, WithQuota(&Quota{Service: 2}))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := uc.GetNodeID(ctx, request("", "foo", i))
+		assert.NoError(t, err)
+	}
+	_, err := uc.GetNodeID(ctx, request("", "foo", 2))
+	assert.Truef(t, errors.Is(err, ErrQuotaExceeded), "unexpected error: %v", err)
+
+	// 已有编号的恢复不受配额限制
+	_, err = uc.GetNodeID(ctx, request("", "foo", 0))
+	assert.NoError(t, err)
+}
+
+func TestQuotaTenantIgnoresExpired(t *testing.T) {
+	uc, named := newTestUseCase(t, WithQuota(&Quota{Tenant: 2}))
+	ctx := context.Background()
+
+	assert.NoError(t, uc.CreateService(ctx, "shop", &store.ServiceInfo{Name: "foo", LeaseTTL: 60}))
+	old := time.Now().Add(-time.Hour).Format("2006-01-02 15:04:05.000")
+	assert.NoError(t, named.PutKey(ctx, "tenants/shop/nodeId/foo/node_1",
+		[]byte(`{"localIp":"127.0.0.2","localPath":"old","applyTime":"`+old+`"}`), nil))
+
+	_, err := uc.GetNodeID(ctx, request("shop", "foo", 0))
+	assert.NoError(t, err)
+	_, err = uc.GetNodeID(ctx, request("shop", "bar", 0))
+	assert.NoError(t, err)
+	_, err = uc.GetNodeID(ctx, request("shop", "bar", 1))
+	assert.Truef(t, errors.Is(err, ErrQuotaExceeded), "unexpected error: %v", err)
+}
+
+func TestInvalidName(t *testing.T) {
+	uc, _ := newTestUseCase(t)
+	ctx := context.Background()
+
+	for _, req := range []*store.NodeRequest{request("", "", 0), request("", "a b", 0), request("x/y", "foo", 0)} {
+		_, err := uc.GetNodeID(ctx, req)
+		assert.Truef(t, errors.Is(err, ErrInvalidName), "unexpected error: %v", err)
+	}
+}
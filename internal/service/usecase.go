@@ -1,21 +1,306 @@
 package service
 
-import "nodeid/internal/store"
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nodeid/internal/audit"
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnregistered 要求注册时, 服务未注册
+	ErrUnregistered = errors.New("service not registered")
+
+	// ErrInvalidService 服务注册信息不合法
+	ErrInvalidService = errors.New("invalid service settings")
+
+	// ErrInvalidName 租户或服务名不合法
+	ErrInvalidName = errors.New("invalid tenant or service name")
+
+	// ErrInvalidSnapshot 快照中的记录不属于当前租户或格式不对
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+	// ErrAuditDisabled 未开启审计日志
+	ErrAuditDisabled = errors.New("audit log disabled")
+)
 
 type UseCase interface {
-	GetNodeID(path, addr, service string) (int, error)
+	// req.IdempotencyKey不为空时, 窗口期内重复的请求返回相同结果
+	GetNodeID(ctx context.Context, req *store.NodeRequest) (int, error)
+
+	// ReleaseNodeID 释放调用方持有的编号
+	ReleaseNodeID(ctx context.Context, req *store.NodeRequest) (int, error)
+
+	// RenewNodeID 续约调用方持有的编号, 返回服务的租约时长, 0表示不过期
+	RenewNodeID(ctx context.Context, req *store.NodeRequest, nodeID int) (time.Duration, error)
+
+	// ReserveNodeID 管理员为调用方占用指定的编号, 不检查配额
+	ReserveNodeID(ctx context.Context, req *store.NodeRequest, nodeID int) error
+
+	// EvictNodeID 管理员收回编号, 返回原持有者
+	EvictNodeID(ctx context.Context, tenant, service string, nodeID int) (*nid.NameHolder, error)
+
+	// Nodes 列出租户下某个服务占用的编号
+	Nodes(ctx context.Context, tenant, service string) ([]*nid.Node, error)
+
+	// History 编号最近的持有者, 用于追查某个时间点由哪台机器持有
+	History(ctx context.Context, tenant, service string, nodeID int) ([]*nid.Ownership, error)
+
+	// Services 列出租户下的服务及占用的编号数
+	Services(ctx context.Context, tenant string) (map[string]int, error)
+
+	// 服务注册信息的增删改查
+	GetService(ctx context.Context, tenant, service string) (*store.ServiceInfo, error)
+	ListRegistry(ctx context.Context, tenant string) ([]*store.ServiceInfo, error)
+	CreateService(ctx context.Context, tenant string, info *store.ServiceInfo) error
+	UpdateService(ctx context.Context, tenant string, info *store.ServiceInfo) error
+	DeleteService(ctx context.Context, tenant, service string) error
+
+	// Export 导出租户下所有的编号记录
+	Export(ctx context.Context, tenant string) (*nid.Snapshot, error)
+
+	// Import 导入快照中的记录, 记录必须属于tenant, 已存在时按policy处理
+	Import(ctx context.Context, tenant string, snap *nid.Snapshot, policy string) (*nid.ImportResult, error)
+
+	// QueryAudit 查询审计日志
+	QueryAudit(ctx context.Context, f *audit.Filter) ([]*audit.Entry, error)
+
+	// Reconfigure 运行中修改配额、是否要求注册等设置
+	Reconfigure(opts ...Option)
+
+	// Ping 检查依赖的后端是否可用
+	Ping(ctx context.Context) error
 }
 
-func NewUseCase(d store.Dao) UseCase {
-	return &useCaseImpl{
-		dao: d,
+func NewUseCase(d store.Dao, opts ...Option) UseCase {
+	c := &useCaseImpl{dao: d}
+	c.settings.Store(&settings{quota: &Quota{}})
+	for _, o := range opts {
+		o(c)
 	}
+	return c
 }
 
 type useCaseImpl struct {
-	dao store.Dao
+	dao   store.Dao
+	audit *audit.Recorder
+
+	mu       sync.Mutex
+	settings atomic.Value // *settings
+}
+
+// settings 可以在运行中修改的设置, 修改时整体替换
+type settings struct {
+	quota               *Quota
+	requireRegistration bool
+}
+
+func (c *useCaseImpl) current() *settings {
+	return c.settings.Load().(*settings)
+}
+
+func (c *useCaseImpl) update(fn func(*settings)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := *c.current()
+	fn(&s)
+	c.settings.Store(&s)
+}
+
+func (c *useCaseImpl) Reconfigure(opts ...Option) {
+	for _, o := range opts {
+		o(c)
+	}
+}
+
+// checkName 租户和服务名会作为存储key和监控标签的一部分, 写入前检查
+func checkName(tenant, service string) error {
+	if service == "" || !store.ValidName(service, store.MaxServiceLen) || !store.ValidName(tenant, store.MaxTenantLen) {
+		return errors.Wrapf(ErrInvalidName, "%q/%q", tenant, service)
+	}
+	return nil
+}
+
+func (c *useCaseImpl) GetNodeID(ctx context.Context, req *store.NodeRequest) (int, error) {
+	if err := checkName(req.Tenant, req.Service); err != nil {
+		return 0, err
+	}
+	if err := c.allocation(ctx, req); err != nil {
+		return 0, err
+	}
+
+	req.Admit = c.admit(req.Tenant, req.Service)
+	return c.dao.GetNodeID(ctx, req)
+}
+
+// allocation 按注册信息设置分配范围, 要求注册时拒绝未注册的服务
+func (c *useCaseImpl) allocation(ctx context.Context, req *store.NodeRequest) error {
+	info, err := c.dao.GetService(ctx, req.Tenant, req.Service)
+	switch {
+	case err == nil:
+		req.Allocation = info.Allocation()
+	case errors.Is(err, nid.ErrNotFound):
+		if c.current().requireRegistration {
+			return errors.Wrap(ErrUnregistered, req.Service)
+		}
+	default:
+		return err
+	}
+	return nil
+}
+
+func (c *useCaseImpl) ReleaseNodeID(ctx context.Context, req *store.NodeRequest) (int, error) {
+	if err := checkName(req.Tenant, req.Service); err != nil {
+		return 0, err
+	}
+	return c.dao.ReleaseNodeID(ctx, req)
+}
+
+func (c *useCaseImpl) RenewNodeID(ctx context.Context, req *store.NodeRequest, nodeID int) (time.Duration, error) {
+	if err := checkName(req.Tenant, req.Service); err != nil {
+		return 0, err
+	}
+	if err := c.dao.RenewNodeID(ctx, req, nodeID); err != nil {
+		return 0, err
+	}
+
+	info, err := c.dao.GetService(ctx, req.Tenant, req.Service)
+	if errors.Is(err, nid.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(info.LeaseTTL) * time.Second, nil
+}
+
+func (c *useCaseImpl) ReserveNodeID(ctx context.Context, req *store.NodeRequest, nodeID int) error {
+	if err := checkName(req.Tenant, req.Service); err != nil {
+		return err
+	}
+	if err := c.allocation(ctx, req); err != nil {
+		return err
+	}
+	return c.dao.ReserveNodeID(ctx, req, nodeID)
+}
+
+func (c *useCaseImpl) EvictNodeID(ctx context.Context, tenant, service string, nodeID int) (*nid.NameHolder, error) {
+	if err := checkName(tenant, service); err != nil {
+		return nil, err
+	}
+	return c.dao.EvictNodeID(ctx, tenant, service, nodeID)
+}
+
+func (c *useCaseImpl) History(ctx context.Context, tenant, service string, nodeID int) ([]*nid.Ownership, error) {
+	return c.dao.History(ctx, tenant, service, nodeID)
+}
+
+func (c *useCaseImpl) Nodes(ctx context.Context, tenant, service string) ([]*nid.Node, error) {
+	return c.dao.Nodes(ctx, tenant, service)
+}
+
+func (c *useCaseImpl) Services(ctx context.Context, tenant string) (map[string]int, error) {
+	return c.dao.Services(ctx, tenant)
+}
+
+func (c *useCaseImpl) GetService(ctx context.Context, tenant, service string) (*store.ServiceInfo, error) {
+	return c.dao.GetService(ctx, tenant, service)
+}
+
+func (c *useCaseImpl) ListRegistry(ctx context.Context, tenant string) ([]*store.ServiceInfo, error) {
+	return c.dao.ListRegistry(ctx, tenant)
+}
+
+func (c *useCaseImpl) CreateService(ctx context.Context, tenant string, info *store.ServiceInfo) error {
+	if err := info.Validate(); err != nil {
+		return errors.Wrap(ErrInvalidService, err.Error())
+	}
+	if err := c.dao.SaveService(ctx, tenant, info, true); err != nil {
+		return err
+	}
+	c.record(ctx, audit.ActionServiceCreate, tenant, info)
+	return nil
+}
+
+func (c *useCaseImpl) UpdateService(ctx context.Context, tenant string, info *store.ServiceInfo) error {
+	if err := info.Validate(); err != nil {
+		return errors.Wrap(ErrInvalidService, err.Error())
+	}
+	if err := c.dao.SaveService(ctx, tenant, info, false); err != nil {
+		return err
+	}
+	c.record(ctx, audit.ActionServiceUpdate, tenant, info)
+	return nil
+}
+
+func (c *useCaseImpl) DeleteService(ctx context.Context, tenant, service string) error {
+	if err := c.dao.DeleteService(ctx, tenant, service); err != nil {
+		return err
+	}
+	c.record(ctx, audit.ActionServiceDelete, tenant, &store.ServiceInfo{Name: service})
+	return nil
+}
+
+func (c *useCaseImpl) Export(ctx context.Context, tenant string) (*nid.Snapshot, error) {
+	return c.dao.Export(ctx, tenant)
+}
+
+func (c *useCaseImpl) Import(ctx context.Context, tenant string, snap *nid.Snapshot, policy string) (*nid.ImportResult, error) {
+	// 每个服务的分配规则, 未注册的服务为nil, 使用默认范围
+	allocs := make(map[string]*nid.Allocation)
+	for _, r := range snap.Records {
+		serviceKey, _, ok := nid.ParseNodeKey(r.Key)
+		t, service, inRoot := store.ParseServiceKey(serviceKey)
+		if !ok || !inRoot || t != tenant || checkName(t, service) != nil {
+			return nil, errors.Wrapf(ErrInvalidSnapshot, "record %s does not belong to tenant %q", r.Key, tenant)
+		}
+
+		alloc, ok := allocs[service]
+		if !ok {
+			info, err := c.dao.GetService(ctx, tenant, service)
+			switch {
+			case err == nil:
+				alloc = info.Allocation()
+			case !errors.Is(err, nid.ErrNotFound):
+				return nil, err
+			}
+			allocs[service] = alloc
+		}
+		if err := r.Check(alloc); err != nil {
+			return nil, errors.Wrap(ErrInvalidSnapshot, err.Error())
+		}
+	}
+	return c.dao.Import(ctx, snap.Records, policy)
+}
+
+func (c *useCaseImpl) QueryAudit(ctx context.Context, f *audit.Filter) ([]*audit.Entry, error) {
+	if c.audit == nil {
+		return nil, ErrAuditDisabled
+	}
+	return c.audit.Query(ctx, f)
+}
+
+// record 记录管理操作, 编号的分配和释放由nid事件记录
+func (c *useCaseImpl) record(ctx context.Context, action, tenant string, info *store.ServiceInfo) {
+	if c.audit == nil {
+		return
+	}
+	detail, _ := json.Marshal(info)
+	c.audit.Record(ctx, &audit.Entry{
+		Action:  action,
+		Tenant:  tenant,
+		Service: info.Name,
+		Detail:  string(detail),
+	})
 }
 
-func (c *useCaseImpl) GetNodeID(path, addr, service string) (int, error) {
-	return c.dao.GetNodeID(path, addr, service)
+func (c *useCaseImpl) Ping(ctx context.Context) error {
+	return c.dao.Ping(ctx)
 }
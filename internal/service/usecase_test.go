@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"nodeid/internal/store"
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReserveRange(t *testing.T) {
+	uc, _ := newTestUseCase(t)
+	ctx := context.Background()
+
+	assert.NoError(t, uc.CreateService(ctx, "", &store.ServiceInfo{Name: "wide", Bits: 12}))
+	assert.NoError(t, uc.ReserveNodeID(ctx, request("", "wide", 0), 4000))
+
+	err := uc.ReserveNodeID(ctx, request("", "wide", 1), 5000)
+	assert.Truef(t, errors.Is(err, nid.ErrOutOfRange), "unexpected error: %v", err)
+	err = uc.ReserveNodeID(ctx, request("", "narrow", 0), 2000)
+	assert.Truef(t, errors.Is(err, nid.ErrOutOfRange), "unexpected error: %v", err)
+}
+
+func TestImportValidation(t *testing.T) {
+	uc, _ := newTestUseCase(t)
+	ctx := context.Background()
+	value := []byte(`{"localIp":"127.0.0.1","localPath":"/app"}`)
+
+	cases := []struct {
+		key   string
+		value []byte
+		ok    bool
+	}{
+		{"nodeId/foo/node_1", value, true},
+		{"nodeId/foo/node_0", value, false},
+		{"nodeId/foo/node_99999", value, false},
+		{"nodeId/foo/node_01", value, false},
+		{"nodeId/foo/node_2", []byte("garbage"), false},
+		{"tenants/shop/nodeId/foo/node_3", value, false},
+		{"nodeId/foo/bar/node_4", value, false},
+		{"svc/node_1", value, false},
+		{"registry/node_1", value, false},
+	}
+	for _, c := range cases {
+		_, err := uc.Import(ctx, "", &nid.Snapshot{Records: []*nid.Record{{Key: c.key, Value: c.value}}}, nid.ConflictFail)
+		if c.ok {
+			assert.NoError(t, err, c.key)
+		} else {
+			assert.Truef(t, errors.Is(err, ErrInvalidSnapshot), "%s: unexpected error: %v", c.key, err)
+		}
+	}
+}
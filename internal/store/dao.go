@@ -1,13 +1,65 @@
 package store
 
-import "nodeid/pkg/nid"
+import (
+	"context"
+	"strings"
+
+	"nodeid/pkg/nid"
+)
 
 const (
 	nodeIdRoot = "nodeId/"
+	tenantRoot = "tenants/"
 )
 
+// 租户和服务名的最大长度
+const (
+	MaxTenantLen  = 64
+	MaxServiceLen = 128
+)
+
+// Prefixes 存储后端中编号、租户、注册信息等数据的key前缀, 迁移后端时使用
+func Prefixes() []string {
+	return append([]string{nodeIdRoot, tenantRoot, registryRoot}, nid.InternalPrefixes...)
+}
+
+// NodeRequest 申请node id的参数
+type NodeRequest struct {
+	Tenant         string // 为空时使用默认空间
+	Service        string
+	Path           string
+	Addr           string
+	IdempotencyKey string
+
+	// Admit 申请新编号前的检查, 见nid.NameHolder.Admit
+	Admit func(ctx context.Context, held int) error
+
+	// Allocation 服务的分配设置, 为空时使用默认设置
+	Allocation *nid.Allocation
+}
+
 type Dao interface {
-	GetNodeID(path, addr, service string) (int, error)
+	GetNodeID(ctx context.Context, req *NodeRequest) (int, error)
+	ReleaseNodeID(ctx context.Context, req *NodeRequest) (int, error)
+	RenewNodeID(ctx context.Context, req *NodeRequest, nodeID int) error
+	ReserveNodeID(ctx context.Context, req *NodeRequest, nodeID int) error
+	EvictNodeID(ctx context.Context, tenant, service string, nodeID int) (*nid.NameHolder, error)
+	Nodes(ctx context.Context, tenant, service string) ([]*nid.Node, error)
+	History(ctx context.Context, tenant, service string, nodeID int) ([]*nid.Ownership, error)
+	Services(ctx context.Context, tenant string) (map[string]int, error)
+	// LiveServices 各服务占用的未过期编号数, 按注册信息中的租约判断是否过期
+	LiveServices(ctx context.Context, tenant string) (map[string]int, error)
+	Ping(ctx context.Context) error
+
+	// 导出和导入租户下所有的编号记录
+	Export(ctx context.Context, tenant string) (*nid.Snapshot, error)
+	Import(ctx context.Context, records []*nid.Record, policy string) (*nid.ImportResult, error)
+
+	// 服务注册信息, 不存在时返回nid.ErrNotFound
+	GetService(ctx context.Context, tenant, service string) (*ServiceInfo, error)
+	ListRegistry(ctx context.Context, tenant string) ([]*ServiceInfo, error)
+	SaveService(ctx context.Context, tenant string, info *ServiceInfo, create bool) error
+	DeleteService(ctx context.Context, tenant, service string) error
 }
 
 func NewDao(named nid.NodeNamed) Dao {
@@ -20,10 +72,122 @@ type daoImpl struct {
 	nodeNamed nid.NodeNamed
 }
 
-func (d *daoImpl) GetNodeID(path, addr, service string) (int, error) {
-	return d.nodeNamed.GetNodeID(&nid.NameHolder{
-		LocalPath:  path,
-		LocalIP:    addr,
-		ServiceKey: nodeIdRoot + service,
+func (d *daoImpl) GetNodeID(ctx context.Context, req *NodeRequest) (int, error) {
+	return d.nodeNamed.GetNodeIDContext(ctx, &nid.NameHolder{
+		LocalPath:      req.Path,
+		LocalIP:        req.Addr,
+		ServiceKey:     serviceKey(req.Tenant, req.Service),
+		IdempotencyKey: req.IdempotencyKey,
+		Admit:          req.Admit,
+		Allocation:     req.Allocation,
 	})
 }
+
+func (d *daoImpl) ReleaseNodeID(ctx context.Context, req *NodeRequest) (int, error) {
+	return d.nodeNamed.ReleaseNodeID(ctx, &nid.NameHolder{
+		LocalPath:  req.Path,
+		LocalIP:    req.Addr,
+		ServiceKey: serviceKey(req.Tenant, req.Service),
+	})
+}
+
+func (d *daoImpl) RenewNodeID(ctx context.Context, req *NodeRequest, nodeID int) error {
+	return d.nodeNamed.RenewNodeID(ctx, &nid.NameHolder{
+		LocalPath:  req.Path,
+		LocalIP:    req.Addr,
+		ServiceKey: serviceKey(req.Tenant, req.Service),
+	}, nodeID)
+}
+
+func (d *daoImpl) ReserveNodeID(ctx context.Context, req *NodeRequest, nodeID int) error {
+	return d.nodeNamed.ReserveNodeID(ctx, &nid.NameHolder{
+		LocalPath:  req.Path,
+		LocalIP:    req.Addr,
+		ServiceKey: serviceKey(req.Tenant, req.Service),
+		Allocation: req.Allocation,
+	}, nodeID)
+}
+
+func (d *daoImpl) EvictNodeID(ctx context.Context, tenant, service string, nodeID int) (*nid.NameHolder, error) {
+	return d.nodeNamed.EvictNodeID(ctx, serviceKey(tenant, service), nodeID)
+}
+
+func (d *daoImpl) History(ctx context.Context, tenant, service string, nodeID int) ([]*nid.Ownership, error) {
+	return d.nodeNamed.History(ctx, serviceKey(tenant, service), nodeID)
+}
+
+func (d *daoImpl) Nodes(ctx context.Context, tenant, service string) ([]*nid.Node, error) {
+	return d.nodeNamed.Nodes(ctx, serviceKey(tenant, service))
+}
+
+func (d *daoImpl) Services(ctx context.Context, tenant string) (map[string]int, error) {
+	return d.nodeNamed.Services(ctx, serviceRoot(tenant))
+}
+
+func (d *daoImpl) Ping(ctx context.Context) error {
+	return d.nodeNamed.Ping(ctx, nodeIdRoot)
+}
+
+func (d *daoImpl) Export(ctx context.Context, tenant string) (*nid.Snapshot, error) {
+	return nid.Export(ctx, d.nodeNamed, serviceRoot(tenant))
+}
+
+func (d *daoImpl) Import(ctx context.Context, records []*nid.Record, policy string) (*nid.ImportResult, error) {
+	return nid.Import(ctx, d.nodeNamed, records, policy)
+}
+
+// LiveServices 按注册的分配设置统计未过期的编号数
+func (d *daoImpl) LiveServices(ctx context.Context, tenant string) (map[string]int, error) {
+	infos, err := d.ListRegistry(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	allocs := make(map[string]*nid.Allocation, len(infos))
+	for _, info := range infos {
+		allocs[info.Name] = info.Allocation()
+	}
+	return d.nodeNamed.LiveServices(ctx, serviceRoot(tenant), allocs)
+}
+
+// serviceRoot 默认空间沿用nodeId/, 其他租户存放在tenants/<tenant>/nodeId/下, 相互隔离
+func serviceRoot(tenant string) string {
+	if tenant == "" {
+		return nodeIdRoot
+	}
+	return tenantRoot + tenant + "/" + nodeIdRoot
+}
+
+func serviceKey(tenant, service string) string {
+	return serviceRoot(tenant) + service
+}
+
+// ParseServiceKey serviceKey的逆运算, 不在nodeId/或tenants/<tenant>/nodeId/下的key返回false
+func ParseServiceKey(key string) (tenant, service string, ok bool) {
+	if strings.HasPrefix(key, tenantRoot) {
+		ss := strings.SplitN(strings.TrimPrefix(key, tenantRoot), "/"+nodeIdRoot, 2)
+		if len(ss) == 2 {
+			return ss[0], ss[1], true
+		}
+		return "", "", false
+	}
+	if !strings.HasPrefix(key, nodeIdRoot) {
+		return "", "", false
+	}
+	return "", strings.TrimPrefix(key, nodeIdRoot), true
+}
+
+// ValidName 租户、服务名、幂等key等会作为存储key的一部分, 只允许字母、数字和-_.
+func ValidName(key string, maxLen int) bool {
+	if len(key) > maxLen {
+		return false
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
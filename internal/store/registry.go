@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"nodeid/pkg/nid"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	registryRoot = "registry/"
+	timeFormat   = "2006-01-02 15:04:05.000"
+)
+
+// ServiceInfo 服务注册信息及分配设置
+type ServiceInfo struct {
+	Name        string `json:"name"`
+	Owner       string `json:"owner"`
+	Description string `json:"description"`
+	MinID       int    `json:"minId"`    // 0表示从1开始
+	MaxID       int    `json:"maxId"`    // 0表示不超过bits决定的最大值
+	Bits        int    `json:"bits"`     // 编号的位数, 0表示10位
+	LeaseTTL    int    `json:"leaseTtl"` // 租约时长(秒), 0表示永不过期
+	Policy      string `json:"policy"`   // lowest或random, 空表示lowest
+	CreateTime  string `json:"createTime"`
+	UpdateTime  string `json:"updateTime"`
+}
+
+// Allocation 转换为nid的分配设置
+func (s *ServiceInfo) Allocation() *nid.Allocation {
+	alloc := &nid.Allocation{
+		MinID:    s.MinID,
+		MaxID:    s.MaxID,
+		Policy:   s.Policy,
+		LeaseTTL: time.Duration(s.LeaseTTL) * time.Second,
+	}
+	if s.Bits > 0 {
+		max := 1<<uint(s.Bits) - 1
+		if alloc.MaxID == 0 || alloc.MaxID > max {
+			alloc.MaxID = max
+		}
+	}
+	return alloc
+}
+
+// Validate 检查设置是否合法
+func (s *ServiceInfo) Validate() error {
+	switch {
+	case s.Name == "":
+		return errors.New("name is required")
+	case s.Bits < 0 || s.Bits > 31:
+		return errors.Errorf("bits %d out of range [0, 31]", s.Bits)
+	case s.MinID < 0 || s.MaxID < 0:
+		return errors.New("id range must not be negative")
+	case s.MaxID > 0 && s.MaxID < s.MinID:
+		return errors.Errorf("maxId %d is less than minId %d", s.MaxID, s.MinID)
+	case s.LeaseTTL < 0:
+		return errors.New("leaseTtl must not be negative")
+	case s.Policy != "" && s.Policy != nid.PolicyLowest && s.Policy != nid.PolicyRandom:
+		return errors.Errorf("unknown policy %q", s.Policy)
+	}
+
+	bits := s.Bits
+	if bits == 0 {
+		bits = 10
+	}
+	if max := 1<<uint(bits) - 1; s.MaxID > max || s.MinID > max {
+		return errors.Errorf("id range exceeds %d bits", bits)
+	}
+	return nil
+}
+
+func registryKey(tenant, service string) string {
+	if tenant == "" {
+		return registryRoot + service
+	}
+	return tenantRoot + tenant + "/" + registryRoot + service
+}
+
+func (d *daoImpl) GetService(ctx context.Context, tenant, service string) (*ServiceInfo, error) {
+	pair, err := d.nodeNamed.GetKey(ctx, registryKey(tenant, service))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ServiceInfo{}
+	if err := json.Unmarshal(pair.Value, info); err != nil {
+		return nil, errors.Wrap(nid.ErrCorrupted, err.Error())
+	}
+	return info, nil
+}
+
+func (d *daoImpl) ListRegistry(ctx context.Context, tenant string) ([]*ServiceInfo, error) {
+	prefix := registryKey(tenant, "")
+	pairs, err := d.nodeNamed.ListKeys(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*ServiceInfo, 0, len(pairs))
+	for _, pair := range pairs {
+		if strings.Contains(strings.TrimPrefix(strings.TrimPrefix(pair.Key, "/"), prefix), "/") {
+			continue
+		}
+		info := &ServiceInfo{}
+		if json.Unmarshal(pair.Value, info) != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// SaveService create为true时只允许新建, 否则只允许更新已存在的服务
+func (d *daoImpl) SaveService(ctx context.Context, tenant string, info *ServiceInfo, create bool) error {
+	key := registryKey(tenant, info.Name)
+	now := time.Now().Format(timeFormat)
+	info.UpdateTime = now
+
+	if create {
+		info.CreateTime = now
+		data, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		return d.nodeNamed.PutKey(ctx, key, data, nil)
+	}
+
+	pair, err := d.nodeNamed.GetKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	old := &ServiceInfo{}
+	if json.Unmarshal(pair.Value, old) == nil {
+		info.CreateTime = old.CreateTime
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return d.nodeNamed.PutKey(ctx, key, data, pair)
+}
+
+func (d *daoImpl) DeleteService(ctx context.Context, tenant, service string) error {
+	key := registryKey(tenant, service)
+	pair, err := d.nodeNamed.GetKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	return d.nodeNamed.DeleteKey(ctx, key, pair)
+}
@@ -0,0 +1,402 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"nodeid/pkg/log"
+	"nodeid/pkg/nid"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SignatureHeader 请求体的HMAC-SHA256签名, 格式为sha256=<hex>
+	SignatureHeader = "X-Nodeid-Signature"
+	// EventHeader 事件类型
+	EventHeader = "X-Nodeid-Event"
+	// DeliveryHeader 投递编号(ULID), 重试时不变, 接收方可以用来去重
+	DeliveryHeader = "X-Nodeid-Delivery"
+
+	queueSize      = 4096
+	pollInterval   = time.Second
+	minBackoff     = time.Second
+	maxBackoff     = 10 * time.Minute
+	defaultTimeout = 5 * time.Second
+	defaultRetries = 10
+)
+
+// Endpoint 接收通知的地址
+type Endpoint struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"` // 为空表示所有事件
+}
+
+func (e *Endpoint) accept(typ string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload 发送给接收方的内容
+type Payload struct {
+	Delivery string `json:"delivery"`
+	*nid.Event
+}
+
+// delivery 待投递的通知, 持久化在本地队列中, 进程重启后继续投递
+type delivery struct {
+	Event       json.RawMessage `json:"event"`
+	Type        string          `json:"type"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt int64           `json:"nextAttempt"`
+}
+
+// Dispatcher 把编号事件投递到配置的地址, 失败后按指数退避重试.
+// 事件先放入内存队列, 由后台协程写入本地文件; 每个地址有单独的队列和投递协程, 互不阻塞
+type Dispatcher struct {
+	db      *bolt.DB
+	workers []*worker
+	events  chan *nid.Event
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// worker 按入队顺序向一个地址投递
+type worker struct {
+	*Endpoint
+	d           *Dispatcher
+	client      *http.Client
+	maxAttempts int
+	notify      chan struct{}
+}
+
+// New queuePath为本地队列文件, timeout为单次请求超时, maxAttempts为最大投递次数
+func New(queuePath string, endpoints []*Endpoint, timeout time.Duration, maxAttempts int) (*Dispatcher, error) {
+	db, err := bolt.Open(queuePath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "open webhook queue")
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, e := range endpoints {
+			if _, err := tx.CreateBucketIfNotExists([]byte(e.URL)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetries
+	}
+
+	d := &Dispatcher{
+		db:     db,
+		events: make(chan *nid.Event, queueSize),
+		quit:   make(chan struct{}),
+	}
+	client := &http.Client{Timeout: timeout}
+	for _, e := range endpoints {
+		d.workers = append(d.workers, &worker{
+			Endpoint:    e,
+			d:           d,
+			client:      client,
+			maxAttempts: maxAttempts,
+			notify:      make(chan struct{}, 1),
+		})
+	}
+
+	d.wg.Add(1 + len(d.workers))
+	go d.persist()
+	for _, w := range d.workers {
+		go w.run()
+	}
+	return d, nil
+}
+
+// Publish 把事件放入内存队列, 不等待写入文件, 可以直接作为nid.Listener.
+// 队列满时丢弃事件并记录日志
+func (d *Dispatcher) Publish(_ context.Context, ev *nid.Event) {
+	select {
+	case d.events <- ev:
+	default:
+		log.Error().Str("type", ev.Type).Str("service", ev.ServiceKey).Int("nodeId", ev.NodeID).
+			Msg("webhook queue is full, event dropped")
+	}
+}
+
+// Close 停止投递, 内存中的事件写入文件, 未完成的通知保留在队列中
+func (d *Dispatcher) Close() error {
+	close(d.quit)
+	d.wg.Wait()
+	return d.db.Close()
+}
+
+// persist 把内存队列中的事件写入各地址的队列, 每次写入当前积压的所有事件
+func (d *Dispatcher) persist() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case ev := <-d.events:
+			d.enqueue(d.drain(ev))
+		case <-d.quit:
+			// 退出前写入还在内存中的事件
+			select {
+			case ev := <-d.events:
+				d.enqueue(d.drain(ev))
+			default:
+			}
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) drain(ev *nid.Event) []*nid.Event {
+	events := []*nid.Event{ev}
+	for {
+		select {
+		case ev := <-d.events:
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func (d *Dispatcher) enqueue(events []*nid.Event) {
+	notify := make(map[*worker]bool)
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		for _, ev := range events {
+			body, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(&delivery{Event: body, Type: ev.Type})
+			if err != nil {
+				return err
+			}
+
+			for _, w := range d.workers {
+				if !w.accept(ev.Type) {
+					continue
+				}
+				id, err := newDeliveryID()
+				if err != nil {
+					return err
+				}
+				if err := tx.Bucket([]byte(w.URL)).Put([]byte(id), data); err != nil {
+					return err
+				}
+				notify[w] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Int("events", len(events)).Msg("webhook enqueue")
+		return
+	}
+
+	for w := range notify {
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *worker) run() {
+	defer w.d.wg.Done()
+
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+
+	for {
+		w.deliverDue()
+
+		select {
+		case <-w.d.quit:
+			return
+		case <-t.C:
+		case <-w.notify:
+		}
+	}
+}
+
+// deliverDue 按入队顺序投递所有到期的通知
+func (w *worker) deliverDue() {
+	type entry struct {
+		id string
+		dl *delivery
+	}
+
+	now := time.Now().Unix()
+	var due []entry
+	_ = w.d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(w.URL)).ForEach(func(k, v []byte) error {
+			dl := &delivery{}
+			if json.Unmarshal(v, dl) == nil && dl.NextAttempt <= now {
+				due = append(due, entry{string(k), dl})
+			}
+			return nil
+		})
+	})
+
+	for _, e := range due {
+		id, dl := e.id, e.dl
+		select {
+		case <-w.d.quit:
+			return
+		default:
+		}
+
+		err := w.send(id, dl)
+		if err == nil {
+			w.update(id, nil)
+			continue
+		}
+
+		dl.Attempts++
+		if dl.Attempts >= w.maxAttempts {
+			log.Error().Err(err).Str("url", w.URL).Str("type", dl.Type).
+				Int("attempts", dl.Attempts).Msg("webhook dropped")
+			w.update(id, nil)
+			continue
+		}
+
+		dl.NextAttempt = time.Now().Add(backoff(dl.Attempts)).Unix()
+		log.Warn().Err(err).Str("url", w.URL).Int("attempts", dl.Attempts).Msg("webhook retry")
+		w.update(id, dl)
+	}
+}
+
+func (w *worker) send(id string, dl *delivery) error {
+	ev := &nid.Event{}
+	if err := json.Unmarshal(dl.Event, ev); err != nil {
+		return err
+	}
+	body, err := json.Marshal(&Payload{Delivery: id, Event: ev})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, dl.Type)
+	req.Header.Set(DeliveryHeader, id)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// update dl为空时从队列中删除
+func (w *worker) update(id string, dl *delivery) {
+	err := w.d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(w.URL))
+		if dl == nil {
+			return b.Delete([]byte(id))
+		}
+		data, err := json.Marshal(dl)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), data)
+	})
+	if err != nil {
+		log.Error().Err(err).Str("url", w.URL).Msg("webhook update queue")
+	}
+}
+
+// Sign 计算body的签名, 接收方用相同的secret验证
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func backoff(attempts int) time.Duration {
+	d := minBackoff << uint(attempts-1)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	idMu   sync.Mutex
+	lastID [16]byte
+)
+
+// newDeliveryID 生成ULID: 48位毫秒时间戳加80位随机数, 同一毫秒内递增, 按字符串排序即为生成顺序
+func newDeliveryID() (string, error) {
+	idMu.Lock()
+	defer idMu.Unlock()
+
+	var id [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+
+	if bytes.Equal(id[:6], lastID[:6]) {
+		id = lastID
+		for i := 15; i >= 6; i-- {
+			if id[i]++; id[i] != 0 {
+				break
+			}
+		}
+	} else if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	lastID = id
+
+	// 128位按5位一组编码为26个字符, 最高位补两个0
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"nodeid/pkg/nid"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type received struct {
+	payload   *Payload
+	delivery  string
+	signature string
+	body      []byte
+}
+
+func receiver(t *testing.T, status int) (*httptest.Server, chan *received) {
+	ch := make(chan *received, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		p := &Payload{}
+		assert.NoError(t, json.Unmarshal(body, p))
+		ch <- &received{p, r.Header.Get(DeliveryHeader), r.Header.Get(SignatureHeader), body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func wait(t *testing.T, ch chan *received) *received {
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(3 * time.Second):
+		t.Fatal("webhook not delivered")
+		return nil
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	srv, ch := receiver(t, http.StatusOK)
+	d, err := New(t.TempDir()+"/webhook.db", []*Endpoint{
+		{URL: srv.URL, Secret: "s3cret", Events: []string{nid.EventAllocated}},
+	}, time.Second, 3)
+	assert.NoError(t, err)
+	defer d.Close()
+
+	d.Publish(context.Background(), &nid.Event{Type: nid.EventRecovered, ServiceKey: "nodeId/foo", NodeID: 1})
+	d.Publish(context.Background(), &nid.Event{Type: nid.EventAllocated, ServiceKey: "nodeId/foo", NodeID: 2})
+
+	r := wait(t, ch)
+	assert.Equal(t, 2, r.payload.NodeID)
+	assert.Equal(t, nid.EventAllocated, r.payload.Type)
+	assert.Len(t, r.delivery, 26)
+	assert.Equal(t, r.delivery, r.payload.Delivery)
+	assert.Equal(t, Sign("s3cret", r.body), r.signature)
+}
+
+func TestDeadEndpointDoesNotBlock(t *testing.T) {
+	block := make(chan struct{})
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer dead.Close()
+	live, ch := receiver(t, http.StatusOK)
+
+	d, err := New(t.TempDir()+"/webhook.db", []*Endpoint{{URL: dead.URL}, {URL: live.URL}}, 10*time.Second, 3)
+	assert.NoError(t, err)
+	defer d.Close()
+	defer close(block)
+
+	for i := 1; i <= 3; i++ {
+		d.Publish(context.Background(), &nid.Event{Type: nid.EventAllocated, ServiceKey: "nodeId/foo", NodeID: i})
+	}
+	var ids []int
+	var deliveries []string
+	for i := 0; i < 3; i++ {
+		r := wait(t, ch)
+		ids = append(ids, r.payload.NodeID)
+		deliveries = append(deliveries, r.delivery)
+	}
+	assert.Equal(t, []int{1, 2, 3}, ids)
+	assert.True(t, sort.StringsAreSorted(deliveries))
+}
+
+func TestRetry(t *testing.T) {
+	srv, ch := receiver(t, http.StatusInternalServerError)
+	d, err := New(t.TempDir()+"/webhook.db", []*Endpoint{{URL: srv.URL}}, time.Second, 2)
+	assert.NoError(t, err)
+	defer d.Close()
+
+	d.Publish(context.Background(), &nid.Event{Type: nid.EventReleased, ServiceKey: "nodeId/foo", NodeID: 1})
+	first := wait(t, ch)
+	again := wait(t, ch)
+	assert.Equal(t, first.delivery, again.delivery)
+}
+
+func TestDeliveryIDOrder(t *testing.T) {
+	var ids []string
+	for i := 0; i < 1000; i++ {
+		id, err := newDeliveryID()
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.True(t, sort.StringsAreSorted(ids))
+}
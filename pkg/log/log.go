@@ -19,6 +19,8 @@ var (
 	fileWriter logFileWriter
 	filePath   = ""
 	nameFormat = "2006_01_02"
+
+	cacheCloser io.Closer
 )
 
 // Init 模块初始化
@@ -85,6 +87,7 @@ func InitLogWithCacheWriter(path string) io.Closer {
 
 	zerolog.TimeFieldFormat = time.RFC3339 // "2006-01-02 15:04:05.000"
 	log.Logger = log.Output(writer)
+	cacheCloser = writer
 
 	log.Info().Msg("log init success!")
 	return writer
@@ -105,9 +108,12 @@ func SetLevel(lv int) {
 	log.Logger = log.Level(zerolog.Level(lv))
 }
 
-// Close 关闭日志系统
+// Close 关闭日志系统, 把缓存中的日志刷到文件
 func Close() {
 	fileWriter.Close()
+	if cacheCloser != nil {
+		cacheCloser.Close()
+	}
 }
 
 type logFileWriter struct {
@@ -92,11 +92,13 @@ type cacheWriter struct {
 	name     string
 	file     *os.File
 	quit     chan bool
+	once     sync.Once
 }
 
 func (w *cacheWriter) Write(p []byte) (n int, err error) {
 	w.lock.Lock()
 	if int64(w.writebuf.Len()) > w.opts.cachesz {
+		w.lock.Unlock()
 		return 0, fmt.Errorf("no space")
 	}
 	n, err = w.writebuf.Write(p)
@@ -105,6 +107,11 @@ func (w *cacheWriter) Write(p []byte) (n int, err error) {
 }
 
 func (w *cacheWriter) Close() error {
+	w.once.Do(w.close)
+	return nil
+}
+
+func (w *cacheWriter) close() {
 	w.quit <- true
 	<-w.quit
 	w.lock.Lock()
@@ -116,7 +123,6 @@ func (w *cacheWriter) Close() error {
 		f.Sync()
 		f.Close()
 	}
-	return nil
 }
 
 func (w *cacheWriter) run() {
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,3 +14,31 @@ func NewRateLimiter(interval time.Duration, cap int64) gin.HandlerFunc {
 		return "", nil
 	}).Middleware()
 }
+
+// DynamicRateLimiter 限流参数可以在运行中修改, 修改后重新计数
+type DynamicRateLimiter struct {
+	handler atomic.Value
+}
+
+// NewDynamicRateLimiter cap<=0表示不限流
+func NewDynamicRateLimiter(interval time.Duration, cap int64) *DynamicRateLimiter {
+	l := &DynamicRateLimiter{}
+	l.Set(interval, cap)
+	return l
+}
+
+// Set ...
+func (l *DynamicRateLimiter) Set(interval time.Duration, cap int64) {
+	var h gin.HandlerFunc = func(ctx *gin.Context) {}
+	if cap > 0 {
+		h = NewRateLimiter(interval, cap)
+	}
+	l.handler.Store(h)
+}
+
+// Middleware ...
+func (l *DynamicRateLimiter) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		l.handler.Load().(gin.HandlerFunc)(ctx)
+	}
+}
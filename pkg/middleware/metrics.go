@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrCodeKey handler通过ctx.Set写入业务错误码, 供metrics按错误码统计
+const ErrCodeKey = "errCode"
+
+var (
+	requestCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nodeid",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of http requests by route, status and error code.",
+	}, []string{"method", "route", "status", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "nodeid",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of http requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+func init() {
+	prometheus.MustRegister(requestCount, requestDuration)
+}
+
+// NewMetrics 统计每个路由的请求数和耗时
+func NewMetrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		begin := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		code := ""
+		if v, ok := ctx.Get(ErrCodeKey); ok {
+			if c, ok := v.(int); ok {
+				code = strconv.Itoa(c)
+			}
+		}
+
+		method := ctx.Request.Method
+		requestCount.WithLabelValues(method, route, strconv.Itoa(ctx.Writer.Status()), code).Inc()
+		requestDuration.WithLabelValues(method, route).Observe(time.Since(begin).Seconds())
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracing 从请求头中提取trace上下文, 并为每个请求创建span
+func NewTracing() gin.HandlerFunc {
+	tracer := otel.Tracer("nodeid/pkg/middleware")
+	return func(ctx *gin.Context) {
+		req := ctx.Request
+		parent := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		spanCtx, span := tracer.Start(parent, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, req)...),
+		)
+		defer span.End()
+
+		ctx.Request = req.WithContext(spanCtx)
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if v, ok := ctx.Get(ErrCodeKey); ok {
+			if c, ok := v.(int); ok {
+				span.SetAttributes(attribute.Int("nodeid.err_code", c))
+				if c != 0 {
+					span.SetStatus(codes.Error, "bad response")
+				}
+			}
+		}
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package nid
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/docker/libkv/store"
+)
+
+// 分配策略
+const (
+	PolicyLowest = "lowest" // 最小的可用编号
+	PolicyRandom = "random" // 随机选择可用编号
+)
+
+// 随机策略下尝试的次数, 之后退化为顺序查找
+const randomAttempts = 16
+
+// Allocation 服务的分配设置
+type Allocation struct {
+	MinID    int           // 为0时从1开始
+	MaxID    int           // 为0时为MaxNodeID
+	Policy   string        // 为空时为PolicyLowest
+	LeaseTTL time.Duration // 大于0时, 超过TTL未续约(重新申请)的编号可以被回收
+}
+
+func (a *Allocation) bounds() (min, max int) {
+	min, max = 1, MaxNodeID
+	if a == nil {
+		return
+	}
+	if a.MinID > 0 {
+		min = a.MinID
+	}
+	if a.MaxID > 0 {
+		max = a.MaxID
+	}
+	return
+}
+
+// expired 租约过期的编号可以分配给其他持有者
+func (a *Allocation) expired(pair *store.KVPair, now time.Time) bool {
+	if a == nil || a.LeaseTTL <= 0 {
+		return false
+	}
+
+	info := &NameHolder{}
+	if info.DecodeInfo(pair.Value) != nil {
+		return false
+	}
+	applyTime, err := time.ParseInLocation(timeFormat, info.ApplyTime, time.Local)
+	if err != nil {
+		return false
+	}
+	return now.Sub(applyTime) > a.LeaseTTL
+}
+
+// live 未过期的编号数
+func (a *Allocation) live(pairs []*store.KVPair) int {
+	now := time.Now()
+	n := 0
+	for _, pair := range pairs {
+		if !a.expired(pair, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// MakeNewID 选择一个可用的编号, 优先使用从未分配过的编号, 其次回收租约过期的编号.
+// 回收时返回原记录, 用于CAS写入. 没有可用编号时返回0
+func (c *nodeNamed) MakeNewID(pairs []*store.KVPair, alloc *Allocation) (int, *store.KVPair) {
+	min, max := alloc.bounds()
+	now := time.Now()
+
+	used := make(map[int]bool, len(pairs))
+	expired := make(map[int]*store.KVPair)
+	for _, pair := range pairs {
+		id := c.ConvertStringToID(pair.Key)
+		if id == 0 {
+			continue
+		}
+		if alloc.expired(pair, now) {
+			expired[id] = pair
+		}
+		used[id] = true
+	}
+
+	if alloc != nil && alloc.Policy == PolicyRandom && max >= min {
+		for i := 0; i < randomAttempts; i++ {
+			id := min + rand.Intn(max-min+1)
+			if !used[id] {
+				return id, nil
+			}
+		}
+	}
+
+	for id := min; id <= max; id++ {
+		if !used[id] {
+			return id, nil
+		}
+	}
+
+	reclaim := 0
+	for id := range expired {
+		if id >= min && id <= max && (reclaim == 0 || id < reclaim) {
+			reclaim = id
+		}
+	}
+	if reclaim != 0 {
+		return reclaim, expired[reclaim]
+	}
+	return 0, nil
+}
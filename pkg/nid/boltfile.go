@@ -0,0 +1,316 @@
+package nid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// libkv在bolt中每个value前面保存8字节的版本号
+const boltMetadataLen = 8
+
+// ErrBoltLocked bolt文件正在被其他进程使用
+var ErrBoltLocked = errors.New("bolt file is in use by another process")
+
+// BoltRecord bolt文件中的一条记录, Index和Holder只在编号的bucket中解析
+type BoltRecord struct {
+	Bucket string      `json:"bucket"`
+	Key    string      `json:"key"`
+	Index  uint64      `json:"index,omitempty"`
+	Value  []byte      `json:"value"`
+	Holder *NameHolder `json:"holder,omitempty"`
+}
+
+// BoltFile 离线查看和修改NewBoltNamed使用的文件, 不经过libkv.
+// 服务每次读写时才打开文件, 打开等待超过timeout时返回ErrBoltLocked
+type BoltFile struct {
+	db *bolt.DB
+}
+
+// OpenBoltFile readOnly为true时可以和其他只读的进程同时打开
+func OpenBoltFile(path string, readOnly bool, timeout time.Duration) (*BoltFile, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout, ReadOnly: readOnly})
+	if err == bolt.ErrTimeout {
+		return nil, errors.Wrap(ErrBoltLocked, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BoltFile{db: db}, nil
+}
+
+// Close ...
+func (f *BoltFile) Close() error {
+	return f.db.Close()
+}
+
+// Buckets 返回所有bucket及其中的key数量
+func (f *BoltFile) Buckets() (map[string]int, error) {
+	buckets := make(map[string]int)
+	err := f.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			buckets[string(name)] = b.Stats().KeyN
+			return nil
+		})
+	})
+	return buckets, err
+}
+
+// Dump 按key顺序列出bucket中prefix开头的记录, bucket为空时列出所有bucket
+func (f *BoltFile) Dump(bucket, prefix string) ([]*BoltRecord, error) {
+	var records []*BoltRecord
+	err := f.db.View(func(tx *bolt.Tx) error {
+		if bucket != "" && tx.Bucket([]byte(bucket)) == nil {
+			return errors.Wrapf(ErrNotFound, "bucket %s", bucket)
+		}
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if bucket != "" && string(name) != bucket {
+				return nil
+			}
+			c := b.Cursor()
+			for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+				if v == nil {
+					continue // 嵌套的bucket
+				}
+				records = append(records, decodeBoltRecord(string(name), string(k), v))
+			}
+			return nil
+		})
+	})
+	return records, err
+}
+
+// Get 读取编号bucket中的记录, 不存在时返回ErrNotFound
+func (f *BoltFile) Get(key string) (*BoltRecord, error) {
+	var record *BoltRecord
+	err := f.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		record = decodeBoltRecord(bucketName, key, v)
+		return nil
+	})
+	return record, err
+}
+
+// Put 在编号bucket中写入记录, 版本号为bucket中最大的版本号加1, 返回修改前的记录.
+// 编号记录(key以node_结尾)的value必须是持有者信息
+func (f *BoltFile) Put(key string, value []byte) (*BoltRecord, error) {
+	if err := CheckBoltValue(key, value); err != nil {
+		return nil, err
+	}
+
+	var previous *BoltRecord
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		if err != nil {
+			return err
+		}
+
+		var index uint64
+		err = b.ForEach(func(k, v []byte) error {
+			if len(v) >= boltMetadataLen {
+				if i := binary.LittleEndian.Uint64(v[:boltMetadataLen]); i > index {
+					index = i
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			previous = decodeBoltRecord(bucketName, key, v)
+		}
+
+		data := make([]byte, boltMetadataLen, boltMetadataLen+len(value))
+		binary.LittleEndian.PutUint64(data, index+1)
+		return b.Put([]byte(key), append(data, value...))
+	})
+	return previous, err
+}
+
+// CheckBoltValue 检查要写入的内容, 编号记录必须是持有者信息
+func CheckBoltValue(key string, value []byte) error {
+	if !isNodeKey(key) {
+		return nil
+	}
+	holder := &NameHolder{}
+	if err := holder.DecodeInfo(value); err != nil || holder.LocalIP == "" {
+		return errors.Errorf("value of %s must be a holder with localIp", key)
+	}
+	return nil
+}
+
+// Delete 删除编号bucket中的记录, 不存在时返回ErrNotFound
+func (f *BoltFile) Delete(key string) (*BoltRecord, error) {
+	var previous *BoltRecord
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		previous = decodeBoltRecord(bucketName, key, v)
+		return b.Delete([]byte(key))
+	})
+	return previous, err
+}
+
+// PutHolder 把编号记录改为holder持有, ApplyTime为空时使用当前时间
+func (f *BoltFile) PutHolder(key string, holder *NameHolder) (*BoltRecord, error) {
+	if !isNodeKey(key) {
+		return nil, errors.Errorf("%s is not a node id record", key)
+	}
+	if holder.ApplyTime == "" {
+		holder.ApplyTime = time.Now().Format(timeFormat)
+	}
+	value, err := holder.EncodeInfo()
+	if err != nil {
+		return nil, err
+	}
+	return f.Put(key, value)
+}
+
+// Backup 把开始复制时的内容写入path
+func (f *BoltFile) Backup(path string) error {
+	return f.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+// CompactBoltFile 把src中的所有bucket复制到新文件dst, 去掉删除记录后留下的空闲页
+func CompactBoltFile(src, dst string, timeout time.Duration) error {
+	from, err := OpenBoltFile(src, true, timeout)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	return from.compactTo(dst, timeout)
+}
+
+// CompactBoltFileInPlace 压缩path并写回原文件, backup不为空时先把原内容备份到backup.
+// libkv每次读写都重新打开文件, 等待锁的写入会提交到打开时的文件, 所以不能用rename替换.
+// 这里从复制到写回一直持有原文件的排它锁, 写回的是同一个文件, 服务的写入在这之前完成或者在这之后写入新内容.
+// 写回过程中中断会损坏原文件, 需要用backup恢复
+func CompactBoltFileInPlace(path, backup string, timeout time.Duration) error {
+	from, err := OpenBoltFile(path, false, timeout)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	if backup != "" {
+		if err := from.Backup(backup); err != nil {
+			return errors.Wrap(err, "backup")
+		}
+	}
+	tmp := path + ".compact"
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+	if err := from.compactTo(tmp, timeout); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	return rewriteFile(path, data)
+}
+
+// rewriteFile 覆盖写入后截断, 不改变文件的inode
+func rewriteFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	if err := f.Truncate(int64(len(data))); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (f *BoltFile) compactTo(dst string, timeout time.Duration) error {
+	if _, err := os.Stat(dst); err == nil {
+		return errors.Errorf("%s already exists", dst)
+	}
+	to, err := bolt.Open(dst, 0600, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+
+	return f.db.View(func(src *bolt.Tx) error {
+		return to.Update(func(dst *bolt.Tx) error {
+			return src.ForEach(func(name []byte, b *bolt.Bucket) error {
+				nb, err := dst.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(b, nb)
+			})
+		})
+	})
+}
+
+func copyBucket(src, dst *bolt.Bucket) error {
+	dst.FillPercent = 1
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nb, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(src.Bucket(k), nb)
+	})
+}
+
+func decodeBoltRecord(bucket, key string, v []byte) *BoltRecord {
+	r := &BoltRecord{Bucket: bucket, Key: key, Value: append([]byte(nil), v...)}
+	if bucket != bucketName || len(v) < boltMetadataLen {
+		return r
+	}
+
+	r.Index = binary.LittleEndian.Uint64(v[:boltMetadataLen])
+	r.Value = r.Value[boltMetadataLen:]
+	if isNodeKey(key) {
+		holder := &NameHolder{}
+		if holder.DecodeInfo(r.Value) == nil {
+			r.Holder = holder
+		}
+	}
+	return r
+}
+
+func isNodeKey(key string) bool {
+	i := strings.LastIndex(key, "/")
+	for _, prefix := range InternalPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	return i >= 0 && strings.HasPrefix(key[i+1:], nodePrefix)
+}
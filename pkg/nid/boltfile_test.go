@@ -0,0 +1,78 @@
+package nid
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactBoltFileInPlace(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/node.bolt"
+	named, err := NewBoltNamed(path)
+	assert.NoError(t, err)
+	for _, key := range []string{"nodeId/foo/node_1", "nodeId/foo/node_2"} {
+		assert.NoError(t, named.PutKey(ctx, key, []byte(`{"localIp":"127.0.0.1"}`), nil))
+	}
+	assert.NoError(t, named.DeleteKey(ctx, "nodeId/foo/node_2", nil))
+
+	assert.NoError(t, CompactBoltFileInPlace(path, path+".bak", time.Second))
+	_, err = os.Stat(path + ".compact")
+	assert.True(t, os.IsNotExist(err))
+
+	for _, file := range []string{path, path + ".bak"} {
+		f, err := OpenBoltFile(file, true, time.Second)
+		assert.NoError(t, err)
+		records, err := f.Dump(bucketName, "nodeId/")
+		assert.NoError(t, err)
+		assert.Len(t, records, 1)
+		f.Close()
+	}
+
+	// 服务在压缩后继续使用新文件
+	assert.NoError(t, named.PutKey(ctx, "nodeId/foo/node_3", []byte(`{}`), nil))
+	pairs, err := named.ListKeys(ctx, "nodeId/foo/")
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 2)
+}
+
+func TestCompactBoltFileInPlaceWhileWriting(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/node.bolt"
+	named, err := NewBoltNamed(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, named.PutKey(ctx, "nodeId/foo/node_0", []byte(`{"localIp":"127.0.0.1"}`), nil))
+
+	// 压缩期间服务一直写入, 成功的写入在压缩后都能读到
+	written := []string{"nodeId/foo/node_0"}
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			key := fmt.Sprintf("nodeId/foo/node_%d", i)
+			if named.PutKey(ctx, key, []byte(`{"localIp":"127.0.0.1"}`), nil) == nil {
+				written = append(written, key)
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, CompactBoltFileInPlace(path, "", 5*time.Second))
+	}
+	close(stop)
+	<-done
+
+	assert.NotEmpty(t, written)
+	pairs, err := named.ListKeys(ctx, "nodeId/foo/")
+	assert.NoError(t, err)
+	assert.Len(t, pairs, len(written))
+}
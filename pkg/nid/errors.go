@@ -0,0 +1,65 @@
+package nid
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/libkv/store"
+	"github.com/pkg/errors"
+)
+
+// 可以通过errors.Is判断的错误类型
+var (
+	// ErrNotFound key不存在
+	ErrNotFound = store.ErrKeyNotFound
+
+	// ErrConflict 写入时发现记录已被其他请求修改
+	ErrConflict = errors.New("nid: record modified or created concurrently")
+
+	// ErrExhausted 没有可分配的编号
+	ErrExhausted = errors.New("nid: no available node id")
+
+	// ErrBackendUnavailable 后端访问失败
+	ErrBackendUnavailable = errors.New("nid: backend unavailable")
+
+	// ErrCorrupted 记录内容无法解析
+	ErrCorrupted = errors.New("nid: corrupted record")
+
+	// ErrOutOfRange 编号不在服务的分配范围内
+	ErrOutOfRange = errors.New("nid: node id out of range")
+
+	// ErrIdempotencyMismatch 幂等key已被其他holder使用
+	ErrIdempotencyMismatch = errors.New("nid: idempotency key used by another holder")
+)
+
+// BackendError 访问后端失败的详细信息, errors.Is(err, ErrBackendUnavailable)为true
+type BackendError struct {
+	Op  string
+	Key string
+	Err error
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("nid: %s %s: %v", e.Op, e.Key, e.Err)
+}
+
+// Unwrap ...
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// Is ...
+func (e *BackendError) Is(target error) bool {
+	return target == ErrBackendUnavailable
+}
+
+// wrapStoreError 把libkv返回的错误转换为nid定义的错误
+func wrapStoreError(op, key string, err error) error {
+	switch err {
+	case nil, store.ErrKeyNotFound, context.Canceled, context.DeadlineExceeded:
+		return err
+	case store.ErrKeyModified, store.ErrKeyExists:
+		return errors.Wrapf(ErrConflict, "%s %s", op, key)
+	}
+	return &BackendError{Op: op, Key: key, Err: err}
+}
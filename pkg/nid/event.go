@@ -0,0 +1,50 @@
+package nid
+
+import (
+	"context"
+	"time"
+)
+
+// 编号生命周期中的事件
+const (
+	EventAllocated = "allocated" // 分配了新编号
+	EventRecovered = "recovered" // 持有者重新获取到原来的编号
+	EventReclaimed = "reclaimed" // 租约过期的编号分配给了新的持有者
+	EventReleased  = "released"  // 持有者主动释放编号
+	EventEvicted   = "evicted"   // 管理员收回编号
+)
+
+// Event 编号状态变化后通知给Listener
+type Event struct {
+	Type       string      `json:"type"`
+	ServiceKey string      `json:"serviceKey"`
+	NodeID     int         `json:"nodeId"`
+	Holder     *NameHolder `json:"holder,omitempty"`   // 当前持有者, 释放和收回时为空
+	Previous   *NameHolder `json:"previous,omitempty"` // 之前的持有者
+	Time       time.Time   `json:"time"`
+}
+
+// Listener 在写入成功后同步调用, 不应阻塞
+type Listener func(ctx context.Context, ev *Event)
+
+func (c *nodeNamed) emit(ctx context.Context, typ, serviceKey string, nodeID int, holder, previous *NameHolder) {
+	ev := &Event{
+		Type:       typ,
+		ServiceKey: serviceKey,
+		NodeID:     nodeID,
+		Time:       time.Now(),
+	}
+	if holder != nil {
+		h := *holder
+		ev.Holder = &h
+	}
+	if previous != nil {
+		p := *previous
+		ev.Previous = &p
+	}
+
+	c.track(ctx, ev)
+	for _, l := range c.listeners {
+		l(ctx, ev)
+	}
+}
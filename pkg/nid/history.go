@@ -0,0 +1,108 @@
+package nid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	historyRoot        = "history/"
+	defaultHistorySize = 10
+)
+
+// Ownership 编号的一任持有者, HeldUntil为空表示仍在持有
+type Ownership struct {
+	LocalPath string     `json:"localPath"`
+	LocalIP   string     `json:"localIp"`
+	HeldFrom  time.Time  `json:"heldFrom"`
+	HeldUntil *time.Time `json:"heldUntil,omitempty"`
+}
+
+func (c *nodeNamed) historyKey(serviceKey string, nodeID int) string {
+	return historyRoot + c.MakeConsulKey(serviceKey, nodeID)
+}
+
+// History 按时间顺序返回编号最近的持有者, 没有记录时返回ErrNotFound
+func (c *nodeNamed) History(ctx context.Context, serviceKey string, nodeID int) ([]*Ownership, error) {
+	pair, err := c.get(ctx, c.historyKey(serviceKey, nodeID))
+	if err != nil {
+		return nil, err
+	}
+
+	var owners []*Ownership
+	if err := json.Unmarshal(pair.Value, &owners); err != nil {
+		return nil, errors.Wrap(ErrCorrupted, err.Error())
+	}
+	return owners, nil
+}
+
+// track 根据事件更新持有记录, 只保留最近historySize任.
+// 编号已经变更成功, 记录失败不影响调用方
+func (c *nodeNamed) track(ctx context.Context, ev *Event) {
+	if c.historySize <= 0 {
+		return
+	}
+
+	key := c.historyKey(ev.ServiceKey, ev.NodeID)
+	for i := 0; i < c.retryCount; i++ {
+		pair, err := c.get(ctx, key)
+		if err != nil && err != ErrNotFound {
+			return
+		}
+
+		var owners []*Ownership
+		if pair != nil && json.Unmarshal(pair.Value, &owners) != nil {
+			owners = nil
+		}
+
+		owners = updateOwners(owners, ev, c.historySize)
+		data, err := json.Marshal(owners)
+		if err != nil {
+			return
+		}
+		// 同一持有者恢复编号时记录不变, 不再写入
+		if pair != nil && bytes.Equal(pair.Value, data) {
+			return
+		}
+
+		err = c.atomicPut(ctx, key, data, pair)
+		if !errors.Is(err, ErrConflict) {
+			return
+		}
+	}
+}
+
+func updateOwners(owners []*Ownership, ev *Event, size int) []*Ownership {
+	var current *Ownership
+	if n := len(owners); n > 0 && owners[n-1].HeldUntil == nil {
+		current = owners[n-1]
+	}
+
+	h := ev.Holder
+	if ev.Type == EventRecovered && current != nil &&
+		current.LocalIP == h.LocalIP && current.LocalPath == h.LocalPath {
+		return owners
+	}
+
+	if current != nil {
+		until := ev.Time
+		current.HeldUntil = &until
+	}
+
+	if h != nil {
+		owners = append(owners, &Ownership{
+			LocalPath: h.LocalPath,
+			LocalIP:   h.LocalIP,
+			HeldFrom:  ev.Time,
+		})
+	}
+
+	if len(owners) > size {
+		owners = owners[len(owners)-size:]
+	}
+	return owners
+}
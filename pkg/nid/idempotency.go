@@ -0,0 +1,112 @@
+package nid
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/docker/libkv/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	idempotencyRoot          = "idempotency/"
+	defaultIdempotencyWindow = 10 * time.Minute
+)
+
+// idempotencyRecord 幂等key对应的申请结果, 过期后可以被覆盖
+type idempotencyRecord struct {
+	NodeID     int    `json:"nodeId"`
+	LocalIP    string `json:"localIp"`
+	LocalPath  string `json:"localPath"`
+	ExpireTime int64  `json:"expireTime"`
+
+	pair *store.KVPair
+}
+
+func idempotencyKey(holder *NameHolder) string {
+	return idempotencyDir(holder.ServiceKey) + holder.IdempotencyKey
+}
+
+func idempotencyDir(serviceKey string) string {
+	return idempotencyRoot + serviceKey + "/"
+}
+
+// recall 查询幂等key之前的申请结果, NodeID为0表示没有有效的结果
+func (c *nodeNamed) recall(ctx context.Context, holder *NameHolder) (*idempotencyRecord, error) {
+	pair, err := c.get(ctx, idempotencyKey(holder))
+	if err == ErrNotFound {
+		return &idempotencyRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := &idempotencyRecord{}
+	if !record.decode(pair.Value, time.Now()) {
+		return &idempotencyRecord{pair: pair}, nil
+	}
+
+	if record.LocalIP != holder.LocalIP || record.LocalPath != holder.LocalPath {
+		return nil, ErrIdempotencyMismatch
+	}
+
+	record.pair = pair
+	return record, nil
+}
+
+// remember 保存申请结果. 并发请求使用同一个key时以先写入的为准
+func (c *nodeNamed) remember(ctx context.Context, holder *NameHolder, prev *idempotencyRecord, nodeID int) (int, error) {
+	data, err := json.Marshal(&idempotencyRecord{
+		NodeID:     nodeID,
+		LocalIP:    holder.LocalIP,
+		LocalPath:  holder.LocalPath,
+		ExpireTime: time.Now().Add(c.idempotencyWindow).Unix(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = c.atomicPut(ctx, idempotencyKey(holder), data, prev.pair)
+	if errors.Is(err, ErrConflict) {
+		record, err := c.recall(ctx, holder)
+		if err != nil {
+			return 0, err
+		}
+		if record.NodeID != 0 {
+			return record.NodeID, nil
+		}
+	}
+
+	if prev.pair == nil {
+		c.purge(ctx, holder.ServiceKey)
+	}
+
+	// 编号已经申请成功, 保存失败只影响之后的重试, 不作为错误返回
+	return nodeID, nil
+}
+
+// purge 删除服务下过期的幂等记录, 在新的key写入时执行, 失败时等待下一次
+func (c *nodeNamed) purge(ctx context.Context, serviceKey string) {
+	pairs, err := c.list(ctx, idempotencyDir(serviceKey))
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, pair := range pairs {
+		record := &idempotencyRecord{}
+		if strings.HasSuffix(pair.Key, "/") || record.decode(pair.Value, now) {
+			continue
+		}
+		if err := c.delete(ctx, pair.Key, pair); err != nil && !errors.Is(err, ErrConflict) && err != ErrNotFound {
+			return
+		}
+	}
+}
+
+// decode 解析记录, 无法解析或已经过期时返回false
+func (r *idempotencyRecord) decode(data []byte, now time.Time) bool {
+	return json.Unmarshal(data, r) == nil && now.Unix() <= r.ExpireTime
+}
@@ -0,0 +1,63 @@
+package nid
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/libkv/store"
+)
+
+// KV 对后端的通用读写, 和编号分配共用连接、超时、监控和trace.
+// 用于保存服务注册信息、审计日志等附属数据
+type KV interface {
+	// GetKey key不存在时返回ErrNotFound
+	GetKey(ctx context.Context, key string) (*store.KVPair, error)
+
+	// ListKeys 列出prefix开头的所有key, 不存在时返回空
+	ListKeys(ctx context.Context, prefix string) ([]*store.KVPair, error)
+
+	// PutKey previous为空时只在key不存在时写入, 否则要求版本一致, 冲突时返回ErrConflict
+	PutKey(ctx context.Context, key string, value []byte, previous *store.KVPair) error
+
+	// DeleteKey previous不为空时要求版本一致
+	DeleteKey(ctx context.Context, key string, previous *store.KVPair) error
+}
+
+func (c *nodeNamed) GetKey(ctx context.Context, key string) (*store.KVPair, error) {
+	return c.get(ctx, key)
+}
+
+func (c *nodeNamed) ListKeys(ctx context.Context, prefix string) ([]*store.KVPair, error) {
+	pairs, err := c.list(ctx, prefix)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	return pairs, err
+}
+
+func (c *nodeNamed) PutKey(ctx context.Context, key string, value []byte, previous *store.KVPair) error {
+	return c.atomicPut(ctx, key, value, previous)
+}
+
+func (c *nodeNamed) DeleteKey(ctx context.Context, key string, previous *store.KVPair) error {
+	return c.delete(ctx, key, previous)
+}
+
+func (c *nodeNamed) delete(ctx context.Context, key string, previous *store.KVPair) (err error) {
+	_, span := startStoreSpan(ctx, "delete", key)
+	defer func(begin time.Time) {
+		observe("delete", begin, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	err = do(ctx, func() error {
+		if previous == nil {
+			return c.Delete(key)
+		}
+		_, e := c.AtomicDelete(key, previous)
+		return e
+	})
+	if err == nil {
+		c.mirrorKey(ctx, key)
+	}
+	return wrapStoreError("delete", key, err)
+}
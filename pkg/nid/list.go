@@ -0,0 +1,91 @@
+package nid
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/libkv/store"
+)
+
+// listNodes 列出dir下直接存放的编号记录.
+// 后端按前缀匹配, 需要排除nodeId/foobar这类前缀相同的其他目录
+func (c *nodeNamed) listNodes(ctx context.Context, dir string) ([]*store.KVPair, error) {
+	pairs, err := c.list(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	nodes := pairs[:0]
+	for _, pair := range pairs {
+		name, ok := childName(pair.Key, prefix)
+		if !ok || strings.Contains(name, "/") || !strings.HasPrefix(name, nodePrefix) {
+			continue
+		}
+		nodes = append(nodes, pair)
+	}
+	return nodes, nil
+}
+
+func (c *nodeNamed) Nodes(ctx context.Context, serviceKey string) ([]*Node, error) {
+	pairs, err := c.listNodes(ctx, serviceKey)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*Node, 0, len(pairs))
+	for _, pair := range pairs {
+		node := &Node{NodeID: c.ConvertStringToID(pair.Key)}
+		if node.NodeID == 0 || node.DecodeInfo(pair.Value) != nil {
+			continue
+		}
+		node.ServiceKey = serviceKey
+		nodes = append(nodes, node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+	return nodes, nil
+}
+
+func (c *nodeNamed) Services(ctx context.Context, root string) (map[string]int, error) {
+	return c.LiveServices(ctx, root, nil)
+}
+
+func (c *nodeNamed) LiveServices(ctx context.Context, root string, allocs map[string]*Allocation) (map[string]int, error) {
+	pairs, err := c.list(ctx, root)
+	if err == ErrNotFound {
+		return map[string]int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	now := time.Now()
+	services := make(map[string]int)
+	for _, pair := range pairs {
+		name, ok := childName(pair.Key, prefix)
+		ss := strings.Split(name, "/")
+		if !ok || len(ss) != 2 || !strings.HasPrefix(ss[1], nodePrefix) {
+			continue
+		}
+		if !allocs[ss[0]].expired(pair, now) {
+			services[ss[0]]++
+		}
+	}
+	return services, nil
+}
+
+// childName 返回key去掉prefix后的部分, consul返回的key没有开头的/
+func childName(key, prefix string) (string, bool) {
+	key = strings.TrimPrefix(key, "/")
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+	return key[len(prefix):], true
+}
@@ -0,0 +1,62 @@
+package nid
+
+import (
+	"time"
+
+	"github.com/docker/libkv/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	backendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "nodeid",
+		Subsystem: "backend",
+		Name:      "call_duration_seconds",
+		Help:      "Latency of calls to the kv backend.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op"})
+
+	backendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nodeid",
+		Subsystem: "backend",
+		Name:      "call_errors_total",
+		Help:      "Number of failed calls to the kv backend.",
+	}, []string{"op"})
+
+	applyRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nodeid",
+		Name:      "apply_retries_total",
+		Help:      "Number of CAS retries while applying for a new node id.",
+	}, []string{"service"})
+
+	idsHeld = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "nodeid",
+		Name:      "ids_held",
+		Help:      "Number of node ids held per service.",
+	}, []string{"service"})
+
+	idsMax = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "nodeid",
+		Name:      "ids_max",
+		Help:      "Maximum number of node ids per service.",
+	}, []string{"service"})
+)
+
+func init() {
+	prometheus.MustRegister(backendDuration, backendErrors, applyRetries, idsHeld, idsMax)
+}
+
+// observe 记录一次后端调用的耗时和结果, key不存在不算错误
+func observe(op string, begin time.Time, err error) {
+	backendDuration.WithLabelValues(op).Observe(time.Since(begin).Seconds())
+	if err != nil && err != store.ErrKeyNotFound {
+		backendErrors.WithLabelValues(op).Inc()
+	}
+}
+
+// observeUsage 记录服务当前占用的id数
+func observeUsage(service string, held int, alloc *Allocation) {
+	min, max := alloc.bounds()
+	idsHeld.WithLabelValues(service).Set(float64(held))
+	idsMax.WithLabelValues(service).Set(float64(max - min + 1))
+}
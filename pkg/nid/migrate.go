@@ -0,0 +1,156 @@
+package nid
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/docker/libkv/store"
+	"github.com/pkg/errors"
+)
+
+// InternalPrefixes nid自己使用的key前缀, 迁移时需要和编号记录一起复制
+var InternalPrefixes = []string{historyRoot, idempotencyRoot}
+
+// 差异的类型
+const (
+	DiffMissing = "missing" // 只在源后端存在
+	DiffExtra   = "extra"   // 只在目标后端存在
+	DiffChanged = "changed" // 内容不同
+)
+
+// Difference 源和目标后端中内容不同的key, 只在一边存在时另一边为空
+type Difference struct {
+	Key    string `json:"key"`
+	Kind   string `json:"kind"`
+	Source []byte `json:"source,omitempty"`
+	Dest   []byte `json:"dest,omitempty"`
+
+	source, dest *store.KVPair
+}
+
+// MigrateResult 迁移的结果, Differences为迁移前的差异
+type MigrateResult struct {
+	Created     int           `json:"created"`
+	Updated     int           `json:"updated"`
+	Deleted     int           `json:"deleted"`
+	Differences []*Difference `json:"differences,omitempty"`
+}
+
+// Compare 比较两个后端prefixes下所有的key, 返回按key排序的差异
+func Compare(ctx context.Context, src, dst KV, prefixes []string) ([]*Difference, error) {
+	from, err := listAll(ctx, src, prefixes)
+	if err != nil {
+		return nil, errors.Wrap(err, "list source")
+	}
+	to, err := listAll(ctx, dst, prefixes)
+	if err != nil {
+		return nil, errors.Wrap(err, "list destination")
+	}
+
+	var diffs []*Difference
+	for key, s := range from {
+		d, ok := to[key]
+		switch {
+		case !ok:
+			diffs = append(diffs, &Difference{Key: key, Kind: DiffMissing, Source: s.Value, source: s})
+		case !bytes.Equal(s.Value, d.Value):
+			diffs = append(diffs, &Difference{Key: key, Kind: DiffChanged, Source: s.Value, Dest: d.Value, source: s, dest: d})
+		}
+	}
+	for key, d := range to {
+		if _, ok := from[key]; !ok {
+			diffs = append(diffs, &Difference{Key: key, Kind: DiffExtra, Dest: d.Value, dest: d})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+	return diffs, nil
+}
+
+// Migrate 把src中prefixes下的key复制到dst, 使两边一致: 缺少的创建, 不同的覆盖, 多余的删除.
+// 写入时检查dst中的版本, 期间dst被修改时返回ErrConflict, 重新执行即可. dryRun为true时只返回差异
+func Migrate(ctx context.Context, src, dst KV, prefixes []string, dryRun bool) (*MigrateResult, error) {
+	diffs, err := Compare(ctx, src, dst, prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MigrateResult{Differences: diffs}
+	if dryRun {
+		return result, nil
+	}
+
+	// 只统计写入成功的key, 中途失败时result为已完成的部分
+	for _, d := range diffs {
+		switch d.Kind {
+		case DiffMissing:
+			if err = dst.PutKey(ctx, d.Key, d.Source, nil); err == nil {
+				result.Created++
+			}
+		case DiffChanged:
+			if err = dst.PutKey(ctx, d.Key, d.Source, d.dest); err == nil {
+				result.Updated++
+			}
+		case DiffExtra:
+			if err = dst.DeleteKey(ctx, d.Key, d.dest); err == nil {
+				result.Deleted++
+			}
+		}
+		if err != nil {
+			return result, errors.Wrapf(err, "%s %s", d.Kind, d.Key)
+		}
+	}
+	return result, nil
+}
+
+// mirrorKey 写入成功后把key的最新内容同步到mirror, 失败不影响写入的结果, 之后可以用Migrate修复
+func (c *nodeNamed) mirrorKey(ctx context.Context, key string) {
+	if c.mirror == nil {
+		return
+	}
+	if err := syncKey(ctx, c, c.mirror, key); err != nil && c.onMirrorError != nil {
+		c.onMirrorError(key, err)
+	}
+}
+
+func syncKey(ctx context.Context, src, dst KV, key string) error {
+	pair, err := src.GetKey(ctx, key)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	previous, err := dst.GetKey(ctx, key)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	switch {
+	case pair == nil && previous == nil:
+		return nil
+	case pair == nil:
+		return dst.DeleteKey(ctx, key, previous)
+	case previous != nil && bytes.Equal(pair.Value, previous.Value):
+		return nil
+	}
+	return dst.PutKey(ctx, key, pair.Value, previous)
+}
+
+// listAll 列出prefixes下的所有key, 去掉目录和开头的/
+func listAll(ctx context.Context, kv KV, prefixes []string) (map[string]*store.KVPair, error) {
+	pairs := make(map[string]*store.KVPair)
+	for _, prefix := range prefixes {
+		list, err := kv.ListKeys(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range list {
+			key := strings.TrimPrefix(pair.Key, "/")
+			if key == "" || strings.HasSuffix(key, "/") {
+				continue
+			}
+			pairs[key] = pair
+		}
+	}
+	return pairs, nil
+}
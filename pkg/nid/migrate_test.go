@@ -0,0 +1,72 @@
+package nid
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/libkv/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorTo(t *testing.T) {
+	ctx := context.Background()
+	dst, err := NewBoltNamed(t.TempDir() + "/mirror.bolt")
+	assert.NoError(t, err)
+	var failed []string
+	src, err := NewBoltNamed(t.TempDir()+"/node.bolt", MirrorTo(dst, func(key string, err error) {
+		failed = append(failed, key)
+	}))
+	assert.NoError(t, err)
+
+	holder := &NameHolder{ServiceKey: "nodeId/foo", LocalIP: "127.0.0.1", LocalPath: "/app", IdempotencyKey: "k"}
+	_, err = src.GetNodeIDContext(ctx, holder)
+	assert.NoError(t, err)
+	assert.NoError(t, src.PutKey(ctx, "registry/foo", []byte(`{}`), nil))
+	_, err = src.ReleaseNodeID(ctx, holder)
+	assert.NoError(t, err)
+
+	// 释放的编号在mirror中也被删除, 历史和注册信息同步写入
+	pairs, err := dst.ListKeys(ctx, "nodeId/foo/")
+	assert.NoError(t, err)
+	assert.Empty(t, pairs)
+	pairs, err = dst.ListKeys(ctx, historyRoot)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pairs)
+	diffs, err := Compare(ctx, src, dst, append([]string{"nodeId/", "registry/"}, InternalPrefixes...))
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+	assert.Empty(t, failed)
+}
+
+// failingKV 写入指定的key时失败
+type failingKV struct {
+	KV
+	key string
+}
+
+func (f *failingKV) PutKey(ctx context.Context, key string, value []byte, previous *store.KVPair) error {
+	if key == f.key {
+		return errors.New("write failed")
+	}
+	return f.KV.PutKey(ctx, key, value, previous)
+}
+
+func TestMigrateCountsWrites(t *testing.T) {
+	ctx := context.Background()
+	src, err := NewBoltNamed(t.TempDir() + "/src.bolt")
+	assert.NoError(t, err)
+	dst, err := NewBoltNamed(t.TempDir() + "/dst.bolt")
+	assert.NoError(t, err)
+	for _, key := range []string{"nodeId/foo/node_1", "nodeId/foo/node_2", "nodeId/foo/node_3"} {
+		assert.NoError(t, src.PutKey(ctx, key, []byte(`{}`), nil))
+	}
+
+	result, err := Migrate(ctx, src, &failingKV{dst, "nodeId/foo/node_2"}, []string{"nodeId/"}, false)
+	assert.Error(t, err)
+	assert.Equal(t, 1, result.Created)
+
+	result, err = Migrate(ctx, src, dst, []string{"nodeId/"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Created)
+}
@@ -1,8 +1,14 @@
 package nid
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/libkv/store"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,3 +39,361 @@ func TestNewBoltNamed(t *testing.T) {
 	assert.NoErrorf(t, err, "failed to get node id")
 	assert.NotEqualf(t, 0, nodeID, "node id is zero")
 }
+
+func TestGetNodeIDContextCanceled(t *testing.T) {
+	named, err := NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoErrorf(t, err, "create failed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = named.GetNodeIDContext(ctx, &NameHolder{
+		LocalPath:  "test",
+		LocalIP:    "127.0.0.1:8500",
+		ServiceKey: "atlas/nodeIds",
+	})
+	assert.Truef(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+}
+
+func TestErrorTaxonomy(t *testing.T) {
+	err := (&NameHolder{}).DecodeInfo([]byte("{"))
+	assert.Truef(t, errors.Is(err, ErrCorrupted), "unexpected error: %v", err)
+
+	err = wrapStoreError("get", "k", errors.New("connection refused"))
+	assert.Truef(t, errors.Is(err, ErrBackendUnavailable), "unexpected error: %v", err)
+
+	var be *BackendError
+	assert.True(t, errors.As(err, &be))
+	assert.Equal(t, "get", be.Op)
+
+	err = wrapStoreError("atomic_put", "k", store.ErrKeyModified)
+	assert.Truef(t, errors.Is(err, ErrConflict), "unexpected error: %v", err)
+	assert.Equal(t, ErrNotFound, wrapStoreError("get", "k", store.ErrKeyNotFound))
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	named, err := NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoErrorf(t, err, "create failed")
+
+	holder := &NameHolder{
+		LocalPath:      "test",
+		LocalIP:        "127.0.0.1",
+		ServiceKey:     "atlas/idempotent",
+		IdempotencyKey: "retry-1",
+	}
+	first, err := named.GetNodeID(holder)
+	assert.NoErrorf(t, err, "failed to get node id")
+
+	again, err := named.GetNodeID(holder)
+	assert.NoErrorf(t, err, "failed to get node id")
+	assert.Equal(t, first, again)
+
+	_, err = named.GetNodeID(&NameHolder{
+		LocalPath:      "other",
+		LocalIP:        "127.0.0.2",
+		ServiceKey:     "atlas/idempotent",
+		IdempotencyKey: "retry-1",
+	})
+	assert.Truef(t, errors.Is(err, ErrIdempotencyMismatch), "unexpected error: %v", err)
+}
+
+func TestIdempotencyKeyAfterReassign(t *testing.T) {
+	named, err := NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoErrorf(t, err, "create failed")
+	ctx := context.Background()
+
+	holder := &NameHolder{
+		LocalPath:      "test",
+		LocalIP:        "127.0.0.1",
+		ServiceKey:     "atlas/idempotent",
+		IdempotencyKey: "retry-1",
+	}
+	first, err := named.GetNodeID(holder)
+	assert.NoError(t, err)
+
+	_, err = named.ReleaseNodeID(ctx, holder)
+	assert.NoError(t, err)
+	other, err := named.GetNodeID(&NameHolder{LocalPath: "other", LocalIP: "127.0.0.2", ServiceKey: "atlas/idempotent"})
+	assert.NoError(t, err)
+	assert.Equal(t, first, other)
+
+	again, err := named.GetNodeID(holder)
+	assert.NoError(t, err)
+	assert.NotEqual(t, other, again)
+
+	nodes, err := named.Nodes(ctx, "atlas/idempotent")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 2)
+
+	// 重试使用新的编号
+	retry, err := named.GetNodeID(holder)
+	assert.NoError(t, err)
+	assert.Equal(t, again, retry)
+}
+
+func TestIdempotencyPurge(t *testing.T) {
+	named, err := NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoErrorf(t, err, "create failed")
+	ctx := context.Background()
+
+	expired := idempotencyRoot + "atlas/idempotent/old"
+	assert.NoError(t, named.PutKey(ctx, expired, []byte(`{"nodeId":1,"expireTime":1}`), nil))
+
+	_, err = named.GetNodeID(&NameHolder{
+		LocalPath:      "test",
+		LocalIP:        "127.0.0.1",
+		ServiceKey:     "atlas/idempotent",
+		IdempotencyKey: "retry-1",
+	})
+	assert.NoError(t, err)
+
+	_, err = named.GetKey(ctx, expired)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = named.GetKey(ctx, idempotencyRoot+"atlas/idempotent/retry-1")
+	assert.NoError(t, err)
+}
+
+func TestAdmitAfterWrite(t *testing.T) {
+	named, err := NewBoltNamed(t.TempDir() + "/node.bolt")
+	assert.NoErrorf(t, err, "create failed")
+	ctx := context.Background()
+
+	calls := 0
+	holder := &NameHolder{
+		LocalPath:  "test",
+		LocalIP:    "127.0.0.1",
+		ServiceKey: "atlas/quota",
+		Admit: func(ctx context.Context, held int) error {
+			calls++
+			if calls == 1 {
+				// 检查通过后, 另一个请求在写入前占用了最后一个编号
+				return named.PutKey(ctx, "atlas/quota/node_9", []byte(`{"localIp":"127.0.0.2"}`), nil)
+			}
+			if held >= 1 {
+				return errors.New("quota exceeded")
+			}
+			return nil
+		},
+	}
+	_, err = named.GetNodeID(holder)
+	assert.EqualError(t, err, "quota exceeded")
+	assert.Equal(t, 2, calls)
+
+	nodes, err := named.Nodes(ctx, "atlas/quota")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, 9, nodes[0].NodeID)
+}
+
+// listFailingStore fail为true时List失败
+type listFailingStore struct {
+	store.Store
+	fail bool
+}
+
+func (s *listFailingStore) List(key string) ([]*store.KVPair, error) {
+	if s.fail {
+		return nil, errors.New("connection refused")
+	}
+	return s.Store.List(key)
+}
+
+func TestReadmitBackendError(t *testing.T) {
+	kv, err := OpenStore("bolt", t.TempDir()+"/node.bolt")
+	assert.NoError(t, err)
+	fs := &listFailingStore{Store: kv}
+	named := newNodeNamed(fs)
+
+	holder := &NameHolder{
+		LocalPath:  "test",
+		LocalIP:    "127.0.0.1",
+		ServiceKey: "atlas/quota",
+		Admit: func(ctx context.Context, held int) error {
+			// 写入后无法再次检查配额
+			fs.fail = true
+			return nil
+		},
+	}
+	_, err = named.GetNodeID(holder)
+	assert.Truef(t, errors.Is(err, ErrBackendUnavailable), "unexpected error: %v", err)
+
+	// 写入的记录已撤销
+	fs.fail = false
+	nodes, err := named.Nodes(context.Background(), "atlas/quota")
+	assert.NoError(t, err)
+	assert.Empty(t, nodes)
+}
+
+func TestMakeNewIDWithAllocation(t *testing.T) {
+	c := &nodeNamed{}
+	expired, _ := (&NameHolder{ApplyTime: time.Now().Add(-time.Hour).Format(timeFormat)}).EncodeInfo()
+	live, _ := (&NameHolder{ApplyTime: time.Now().Format(timeFormat)}).EncodeInfo()
+	pairs := []*store.KVPair{
+		{Key: c.MakeConsulKey("svc", 10), Value: expired},
+		{Key: c.MakeConsulKey("svc", 11), Value: live},
+		{Key: c.MakeConsulKey("svc", 300), Value: live},
+	}
+
+	id, pair := c.MakeNewID(pairs, nil)
+	assert.Equal(t, 1, id)
+	assert.Nil(t, pair)
+
+	alloc := &Allocation{MinID: 10, MaxID: 12}
+	id, _ = c.MakeNewID(pairs, alloc)
+	assert.Equal(t, 12, id)
+
+	alloc = &Allocation{MinID: 10, MaxID: 11, LeaseTTL: time.Minute}
+	id, pair = c.MakeNewID(pairs, alloc)
+	assert.Equal(t, 10, id)
+	assert.Equal(t, pairs[0], pair)
+
+	alloc = &Allocation{MinID: 11, MaxID: 11}
+	id, _ = c.MakeNewID(pairs, alloc)
+	assert.Equal(t, 0, id)
+}
+
+func TestUpdateOwners(t *testing.T) {
+	now := time.Now()
+	a := &NameHolder{LocalIP: "10.0.0.1"}
+	b := &NameHolder{LocalIP: "10.0.0.2"}
+
+	owners := updateOwners(nil, &Event{Type: EventAllocated, Holder: a, Time: now}, 2)
+	owners = updateOwners(owners, &Event{Type: EventRecovered, Holder: a, Time: now.Add(time.Second)}, 2)
+	assert.Len(t, owners, 1)
+	assert.Nil(t, owners[0].HeldUntil)
+
+	owners = updateOwners(owners, &Event{Type: EventReclaimed, Holder: b, Previous: a, Time: now.Add(time.Minute)}, 2)
+	assert.Len(t, owners, 2)
+	assert.Equal(t, now.Add(time.Minute), *owners[0].HeldUntil)
+	assert.Equal(t, "10.0.0.2", owners[1].LocalIP)
+
+	owners = updateOwners(owners, &Event{Type: EventReleased, Previous: b, Time: now.Add(time.Hour)}, 2)
+	owners = updateOwners(owners, &Event{Type: EventAllocated, Holder: a, Time: now.Add(2 * time.Hour)}, 2)
+	assert.Len(t, owners, 2)
+	assert.Equal(t, now.Add(time.Hour), *owners[0].HeldUntil)
+	assert.Equal(t, "10.0.0.1", owners[1].LocalIP)
+	assert.Nil(t, owners[1].HeldUntil)
+}
+
+// historyWrites 统计历史记录的写入次数
+type historyWrites struct {
+	store.Store
+	n int
+}
+
+func (s *historyWrites) AtomicPut(key string, value []byte, previous *store.KVPair, options *store.WriteOptions) (bool, *store.KVPair, error) {
+	if strings.HasPrefix(key, historyRoot) {
+		s.n++
+	}
+	return s.Store.AtomicPut(key, value, previous, options)
+}
+
+func TestTrackSkipsUnchanged(t *testing.T) {
+	kv, err := OpenStore("bolt", t.TempDir()+"/node.bolt")
+	assert.NoError(t, err)
+	hw := &historyWrites{Store: kv}
+	named := newNodeNamed(hw)
+	ctx := context.Background()
+
+	holder := &NameHolder{LocalPath: "test", LocalIP: "127.0.0.1", ServiceKey: "atlas/history"}
+	id, err := named.GetNodeIDContext(ctx, holder)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hw.n)
+
+	// 同一持有者恢复编号不写历史记录
+	_, err = named.GetNodeIDContext(ctx, holder)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hw.n)
+
+	_, err = named.ReleaseNodeID(ctx, holder)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, hw.n)
+	owners, err := named.History(ctx, "atlas/history", id)
+	assert.NoError(t, err)
+	if assert.Len(t, owners, 1) {
+		assert.NotNil(t, owners[0].HeldUntil)
+	}
+}
+
+func TestSnapshotNDJSON(t *testing.T) {
+	snap := &Snapshot{Version: SnapshotVersion, Root: "nodeId/", Records: []*Record{
+		{Key: "nodeId/foo/node_1", Value: []byte(`{"localIp":"10.0.0.1"}`), Version: 3, NodeID: 1},
+		{Key: "nodeId/foo/node_2", Value: []byte(`{"localIp":"10.0.0.2"}`), Version: 5, NodeID: 2},
+	}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSnapshot(&buf, snap, true))
+	assert.Equal(t, 3, strings.Count(buf.String(), "\n"))
+
+	got, err := ReadSnapshot(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, snap.Records, got.Records)
+
+	_, err = ReadSnapshot(strings.NewReader(`{"version":2}`))
+	assert.Error(t, err)
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	src, err := NewBoltNamed(dir + "/src.bolt")
+	assert.NoError(t, err)
+	defer src.Close()
+	dst, err := NewBoltNamed(dir + "/dst.bolt")
+	assert.NoError(t, err)
+	defer dst.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, src.PutKey(ctx, "nodeId/foo/node_1", []byte("a"), nil))
+	assert.NoError(t, src.PutKey(ctx, "nodeId/foo/node_2", []byte("b"), nil))
+	assert.NoError(t, dst.PutKey(ctx, "nodeId/foo/node_2", []byte("c"), nil))
+	assert.NoError(t, dst.PutKey(ctx, "nodeId/foo/node_3", []byte("d"), nil))
+
+	prefixes := []string{"nodeId/"}
+	result, err := Migrate(ctx, src, dst, prefixes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result.Differences, 3)
+	assert.Equal(t, 0, result.Created)
+
+	result, err = Migrate(ctx, src, dst, prefixes, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 1}, []int{result.Created, result.Updated, result.Deleted})
+
+	diffs, err := Compare(ctx, src, dst, prefixes)
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestBoltFile(t *testing.T) {
+	dir := t.TempDir()
+	named, err := NewBoltNamed(dir + "/node.bolt")
+	assert.NoError(t, err)
+	id, err := named.GetNodeID(&NameHolder{LocalIP: "10.0.0.1", ServiceKey: "nodeId/foo"})
+	assert.NoError(t, err)
+	named.Close()
+
+	f, err := OpenBoltFile(dir+"/node.bolt", false, time.Second)
+	assert.NoError(t, err)
+	records, err := f.Dump(bucketName, "nodeId/")
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "10.0.0.1", records[0].Holder.LocalIP)
+
+	key := records[0].Key
+	assert.Error(t, CheckBoltValue(key, []byte(`{}`)))
+	previous, err := f.PutHolder(key, &NameHolder{LocalIP: "10.0.0.2"})
+	assert.NoError(t, err)
+	assert.Equal(t, records[0].Index, previous.Index)
+	_, err = f.Delete(key)
+	assert.NoError(t, err)
+	_, err = f.Get(key)
+	assert.Equal(t, ErrNotFound, err)
+	assert.NoError(t, f.Close())
+
+	assert.NoError(t, CompactBoltFile(dir+"/node.bolt", dir+"/compact.bolt", time.Second))
+	named, err = NewBoltNamed(dir + "/compact.bolt")
+	assert.NoError(t, err)
+	defer named.Close()
+	again, err := named.GetNodeID(&NameHolder{LocalIP: "10.0.0.3", ServiceKey: "nodeId/foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+}
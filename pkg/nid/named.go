@@ -1,6 +1,7 @@
 package nid
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -11,23 +12,63 @@ import (
 	"github.com/docker/libkv/store"
 	"github.com/docker/libkv/store/boltdb"
 	"github.com/docker/libkv/store/consul"
+	"github.com/docker/libkv/store/etcd"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
-	timeFormat string = "2006-01-02 15:04:05.000"
-	nodePrefix        = "node_"
-	retryCount        = 5
-	bucketName        = "nodeId"
+	timeFormat    string = "2006-01-02 15:04:05.000"
+	nodePrefix           = "node_"
+	retryCount           = 5
+	retryInterval        = 50 * time.Millisecond
+	bucketName           = "nodeId"
 )
 
+// MaxNodeID 可分配的最大编号(snowflake 10位节点号)
+const MaxNodeID = 1<<10 - 1
+
 func init() {
 	consul.Register()
+	etcd.Register()
 	boltdb.Register()
 }
 
 type NodeNamed interface {
+	KV
+
 	GetNodeID(*NameHolder) (int, error)
+	GetNodeIDContext(context.Context, *NameHolder) (int, error)
+
+	// ReleaseNodeID 释放holder持有的编号
+	ReleaseNodeID(context.Context, *NameHolder) (int, error)
+
+	// RenewNodeID 续约holder持有的编号, 不产生recovered事件
+	RenewNodeID(ctx context.Context, holder *NameHolder, nodeID int) error
+
+	// ReserveNodeID 为holder占用指定的编号, 不检查配额
+	ReserveNodeID(ctx context.Context, holder *NameHolder, nodeID int) error
+
+	// EvictNodeID 收回服务的编号, 返回原持有者
+	EvictNodeID(ctx context.Context, serviceKey string, nodeID int) (*NameHolder, error)
+
+	// History 按时间顺序返回编号最近的持有者
+	History(ctx context.Context, serviceKey string, nodeID int) ([]*Ownership, error)
+
+	// Nodes 列出服务下所有被占用的编号
+	Nodes(ctx context.Context, serviceKey string) ([]*Node, error)
+
+	// Services 列出root下的所有服务及其占用的编号数
+	Services(ctx context.Context, root string) (map[string]int, error)
+
+	// LiveServices 和Services相同, 但不计算租约过期的编号. allocs为各服务的分配设置, 没有设置的服务不会过期
+	LiveServices(ctx context.Context, root string, allocs map[string]*Allocation) (map[string]int, error)
+
+	// Ping 读取一次key检查后端是否可用, key不存在不算失败
+	Ping(ctx context.Context, key string) error
+
+	// Close 关闭与后端的连接
+	Close()
 }
 
 // NameHolder ...
@@ -36,102 +77,160 @@ type NameHolder struct {
 	LocalIP    string `json:"localIp"`
 	ApplyTime  string `json:"applyTime"`
 	ServiceKey string `json:"-"`
+
+	// IdempotencyKey 不为空时, 窗口期内相同key的请求返回相同的结果
+	IdempotencyKey string `json:"-"`
+
+	// Admit 不为空时, 申请新编号前调用, held为服务中其他持有者占用的未过期编号数, 返回错误则拒绝申请.
+	// 写入后会再调用一次, 并发的申请同时通过检查时, 返回错误的一方撤销写入. 已有编号的恢复不受影响
+	Admit func(ctx context.Context, held int) error `json:"-"`
+
+	// Allocation 为空时在[1, MaxNodeID]中分配最小的可用编号
+	Allocation *Allocation `json:"-"`
+}
+
+// Node 被占用的编号及其持有者
+type Node struct {
+	NodeID int `json:"nodeId"`
+	NameHolder
 }
 
 func (h *NameHolder) DecodeInfo(data []byte) error {
-	err := json.Unmarshal(data, h)
-	return err
+	if err := json.Unmarshal(data, h); err != nil {
+		return errors.Wrap(ErrCorrupted, err.Error())
+	}
+	return nil
 }
 
 func (h *NameHolder) EncodeInfo() ([]byte, error) {
 	return json.Marshal(h)
 }
 
-func NewConsulNamed(addr string) (NodeNamed, error) {
-	kvStore, err := libkv.NewStore(
-		store.CONSUL,
-		[]string{addr},
-		&store.Config{
-			ConnectionTimeout: 10 * time.Second,
-		},
-	)
-
-	if err != nil {
-		return nil, err
-	}
+func NewConsulNamed(addr string, opts ...Option) (NodeNamed, error) {
+	return Open("consul", addr, opts...)
+}
 
-	return &nodeNamed{
-		Store:      kvStore,
-		retryCount: retryCount,
-	}, nil
+func NewEtcdNamed(addr string, opts ...Option) (NodeNamed, error) {
+	return Open("etcd", addr, opts...)
 }
 
-func NewEtcdNamed(addr string) (NodeNamed, error) {
-	kvStore, err := libkv.NewStore(
-		store.ETCD,
-		[]string{addr},
-		&store.Config{
-			ConnectionTimeout: 10 * time.Second,
-		},
-	)
+func NewBoltNamed(addr string, opts ...Option) (NodeNamed, error) {
+	return Open("bolt", addr, opts...)
+}
 
+// Open 按名字连接存储后端: consul、etcd、bolt
+func Open(backend, addr string, opts ...Option) (NodeNamed, error) {
+	kvStore, err := OpenStore(backend, addr)
 	if err != nil {
 		return nil, err
 	}
 
-	return &nodeNamed{
-		Store:      kvStore,
-		retryCount: retryCount,
-	}, nil
+	return newNodeNamed(kvStore, opts...), nil
 }
 
-func NewBoltNamed(addr string) (NodeNamed, error) {
-	kvStore, err := libkv.NewStore(
-		store.BOLTDB,
-		[]string{addr},
-		&store.Config{
-			ConnectionTimeout: 10 * time.Second,
-			Bucket:            bucketName,
-		},
-	)
+// OpenStore 按名字连接存储后端, 返回libkv的store. 和Open使用相同的连接参数, bolt使用相同的bucket
+func OpenStore(backend, addr string) (store.Store, error) {
+	conf := &store.Config{
+		ConnectionTimeout: 10 * time.Second,
+	}
 
-	if err != nil {
-		return nil, err
+	var b store.Backend
+	switch backend {
+	case "consul":
+		b = store.CONSUL
+	case "etcd":
+		b = store.ETCD
+	case "bolt":
+		b = store.BOLTDB
+		conf.Bucket = bucketName
+	default:
+		return nil, errors.Errorf("unknown backend %q, must be consul, etcd or bolt", backend)
 	}
+	return libkv.NewStore(b, []string{addr}, conf)
+}
 
-	return &nodeNamed{
-		Store:      kvStore,
-		retryCount: retryCount,
-	}, nil
+func newNodeNamed(kvStore store.Store, opts ...Option) *nodeNamed {
+	c := &nodeNamed{
+		Store:             kvStore,
+		retryCount:        retryCount,
+		idempotencyWindow: defaultIdempotencyWindow,
+		historySize:       defaultHistorySize,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
 }
 
 type nodeNamed struct {
 	store.Store
-	retryCount int
+	retryCount        int
+	idempotencyWindow time.Duration
+	historySize       int
+	listeners         []Listener
+
+	mirror        KV
+	onMirrorError func(key string, err error)
+}
+
+func (c *nodeNamed) GetNodeID(holder *NameHolder) (int, error) {
+	return c.GetNodeIDContext(context.Background(), holder)
 }
 
-func (c *nodeNamed) GetNodeID(holder *NameHolder) (nodeID int, err error) {
-	nodeID, err = c.RecoverNodeID(holder)
+func (c *nodeNamed) GetNodeIDContext(ctx context.Context, holder *NameHolder) (nodeID int, err error) {
+	ctx, span := startSpan(ctx, "nid.GetNodeID", holder)
+	defer func() { endSpan(span, err) }()
+
+	var record *idempotencyRecord
+	if holder.IdempotencyKey != "" {
+		record, err = c.recall(ctx, holder)
+		if err != nil {
+			return 0, err
+		}
+		// 记录中的编号可能已被释放或回收给其他持有者, 仍由holder持有时才返回
+		if record.NodeID != 0 {
+			held, err := c.hold(ctx, holder, record.NodeID)
+			if err != nil {
+				return 0, err
+			}
+			if held {
+				c.emit(ctx, EventRecovered, holder.ServiceKey, record.NodeID, holder, nil)
+				span.SetAttributes(attribute.Int("nodeid.id", record.NodeID))
+				return record.NodeID, nil
+			}
+		}
+	}
+
+	nodeID, err = c.RecoverNodeID(ctx, holder)
 	if err != nil {
 		return
 	}
 
 	if nodeID == 0 {
-		nodeID, err = c.ApplyNodeID(holder)
+		nodeID, err = c.ApplyNodeID(ctx, holder)
+	}
+
+	if err == nil && record != nil {
+		nodeID, err = c.remember(ctx, holder, record, nodeID)
 	}
 
+	span.SetAttributes(attribute.Int("nodeid.id", nodeID))
 	return
 }
 
 // 恢复配置
-func (c *nodeNamed) RecoverNodeID(holder *NameHolder) (int, error) {
-	kvPairs, err := c.List(holder.ServiceKey)
+func (c *nodeNamed) RecoverNodeID(ctx context.Context, holder *NameHolder) (nodeID int, err error) {
+	ctx, span := startSpan(ctx, "nid.RecoverNodeID", holder)
+	defer func() { endSpan(span, err) }()
+
+	kvPairs, err := c.listNodes(ctx, holder.ServiceKey)
 	if err != nil {
-		if err != store.ErrKeyNotFound {
+		if err != ErrNotFound {
 			return 0, err
 		}
 		err = nil
 	}
+	observeUsage(holder.ServiceKey, holder.Allocation.live(kvPairs), holder.Allocation)
 
 	for _, pair := range kvPairs {
 		info := &NameHolder{}
@@ -141,57 +240,174 @@ func (c *nodeNamed) RecoverNodeID(holder *NameHolder) (int, error) {
 			continue
 		}
 
-		if err := c.TryHold(pair, holder); err != nil {
+		if err := c.TryHold(ctx, pair, holder); err != nil {
 			return 0, err
 		}
 
-		return c.ConvertStringToID(pair.Key), nil
+		nodeID = c.ConvertStringToID(pair.Key)
+		c.emit(ctx, EventRecovered, holder.ServiceKey, nodeID, holder, nil)
+		return nodeID, nil
 	}
 	return 0, nil
 }
 
+// RenewNodeID holder仍持有nodeID时刷新ApplyTime, 不产生事件. 编号已被释放或收回时返回ErrNotFound
+func (c *nodeNamed) RenewNodeID(ctx context.Context, holder *NameHolder, nodeID int) (err error) {
+	ctx, span := startSpan(ctx, "nid.RenewNodeID", holder)
+	defer func() { endSpan(span, err) }()
+
+	held, err := c.hold(ctx, holder, nodeID)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return errors.Wrapf(ErrNotFound, "%s is not held by %s:%s",
+			c.MakeConsulKey(holder.ServiceKey, nodeID), holder.LocalIP, holder.LocalPath)
+	}
+	return nil
+}
+
+// hold holder仍持有nodeID时刷新ApplyTime, 否则返回false
+func (c *nodeNamed) hold(ctx context.Context, holder *NameHolder, nodeID int) (bool, error) {
+	pair, err := c.get(ctx, c.MakeConsulKey(holder.ServiceKey, nodeID))
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	info := &NameHolder{}
+	if info.DecodeInfo(pair.Value) != nil ||
+		info.LocalIP != holder.LocalIP ||
+		info.LocalPath != holder.LocalPath {
+		return false, nil
+	}
+
+	if err := c.TryHold(ctx, pair, holder); err != nil {
+		if errors.Is(err, ErrConflict) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // 申请配置
-func (c *nodeNamed) ApplyNodeID(holder *NameHolder) (int, error) {
+func (c *nodeNamed) ApplyNodeID(ctx context.Context, holder *NameHolder) (nodeID int, err error) {
+	ctx, span := startSpan(ctx, "nid.ApplyNodeID", holder)
+	defer func() { endSpan(span, err) }()
+
 	for i := 0; i < c.retryCount; i++ {
-		pairs, err := c.List(holder.ServiceKey)
+		span.SetAttributes(attribute.Int("nodeid.retries", i))
+		if i > 0 {
+			if err := sleepContext(ctx, retryInterval); err != nil {
+				return 0, err
+			}
+		}
+
+		pairs, err := c.listNodes(ctx, holder.ServiceKey)
 		if err != nil {
-			if err != store.ErrKeyNotFound {
+			if err != ErrNotFound {
 				return 0, err
 			}
 			err = nil
 		}
 
-		newID := c.MakeNewID(pairs)
-		if err := c.TryHold(&store.KVPair{
-			Key:       c.MakeConsulKey(holder.ServiceKey, newID),
-			LastIndex: 0,
-		}, holder); err == nil {
+		alloc := holder.Allocation
+		live := alloc.live(pairs)
+		observeUsage(holder.ServiceKey, live, alloc)
+
+		if holder.Admit != nil {
+			if err := holder.Admit(ctx, live); err != nil {
+				return 0, err
+			}
+		}
+
+		if i > 0 {
+			applyRetries.WithLabelValues(holder.ServiceKey).Inc()
+		}
+
+		newID, expired := c.MakeNewID(pairs, alloc)
+		if newID == 0 {
+			min, max := alloc.bounds()
+			return 0, errors.Wrapf(ErrExhausted, "range is [%d, %d]", min, max)
+		}
+
+		pair := expired
+		var previous *NameHolder
+		if pair == nil {
+			pair = &store.KVPair{
+				Key:       c.MakeConsulKey(holder.ServiceKey, newID),
+				LastIndex: 0,
+			}
+		} else {
+			// TryHold会覆盖pair.Value, 先解析出原持有者
+			previous = &NameHolder{}
+			if previous.DecodeInfo(pair.Value) != nil {
+				previous = nil
+			}
+		}
+
+		err = c.TryHold(ctx, pair, holder)
+		if err == nil {
+			if err := c.readmit(ctx, holder, pair.Key); err != nil {
+				return 0, err
+			}
+			if expired == nil {
+				c.emit(ctx, EventAllocated, holder.ServiceKey, newID, holder, nil)
+			} else {
+				c.emit(ctx, EventReclaimed, holder.ServiceKey, newID, holder, previous)
+			}
 			return newID, nil
 		}
+		if !errors.Is(err, ErrConflict) {
+			return 0, err
+		}
 	}
-	return 0, errors.Errorf("try to hold %d times, but failed", c.retryCount)
+	return 0, errors.Wrapf(ErrConflict, "try to hold %d times, but failed", c.retryCount)
 }
 
-func (c *nodeNamed) MakeNewID(pairs []*store.KVPair) int {
-	usedIDs := make([]int, 256)
-	for _, pair := range pairs {
-		nid := c.ConvertStringToID(pair.Key)
-		if nid >= len(usedIDs) {
-			tmp := usedIDs
-			usedIDs := make([]int, nid*2)
-			copy(usedIDs, tmp)
+// readmit 写入后再检查一次配额, 不通过时删除刚写入的记录.
+// 无法读取已占用的编号时也撤销写入并返回错误, 由调用方重试, 避免重试时直接恢复出超额的编号
+func (c *nodeNamed) readmit(ctx context.Context, holder *NameHolder, key string) error {
+	if holder.Admit == nil {
+		return nil
+	}
+	pairs, err := c.listNodes(ctx, holder.ServiceKey)
+	if err != nil {
+		if e := c.delete(ctx, key, nil); e != nil {
+			return errors.Wrapf(err, "recheck quota, undo allocation: %v", e)
 		}
-		usedIDs[nid] = nid
+		return errors.Wrap(err, "recheck quota")
 	}
 
-	newID := 1
-	for ; newID < len(usedIDs); newID++ {
-		if usedIDs[newID] == 0 {
-			break
+	var own *store.KVPair
+	others := make([]*store.KVPair, 0, len(pairs))
+	for _, pair := range pairs {
+		if strings.TrimPrefix(pair.Key, "/") == key {
+			own = pair
+		} else {
+			others = append(others, pair)
 		}
 	}
 
-	return newID
+	admitErr := holder.Admit(ctx, holder.Allocation.live(others))
+	if admitErr == nil || own == nil {
+		return nil
+	}
+	if err := c.delete(ctx, own.Key, own); err != nil {
+		return errors.Wrap(err, "undo allocation over quota")
+	}
+	return admitErr
+}
+
+func (c *nodeNamed) Ping(ctx context.Context, key string) error {
+	_, err := c.list(ctx, key)
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
 }
 
 func (c *nodeNamed) ConvertStringToID(s string) int {
@@ -212,15 +428,15 @@ func (c *nodeNamed) MakeConsulKey(nodeKeyPrefix string, id int) string {
 	return nodeKeyPrefix + "/" + fmt.Sprintf("%s%d", nodePrefix, id)
 }
 
-func (c *nodeNamed) TryHold(pair *store.KVPair, holder *NameHolder) error {
-	newPair, err := c.Get(pair.Key)
+func (c *nodeNamed) TryHold(ctx context.Context, pair *store.KVPair, holder *NameHolder) error {
+	newPair, err := c.get(ctx, pair.Key)
 	if err != nil {
-		if err != store.ErrKeyNotFound {
+		if err != ErrNotFound {
 			return err
 		}
 	} else {
 		if newPair.LastIndex > pair.LastIndex {
-			return errors.New("try hold failed")
+			return errors.Wrap(ErrConflict, "try hold failed")
 		}
 	}
 
@@ -231,10 +447,92 @@ func (c *nodeNamed) TryHold(pair *store.KVPair, holder *NameHolder) error {
 	}
 
 	if newPair == nil {
-		_, _, err = c.AtomicPut(pair.Key, pair.Value, nil, nil)
+		err = c.atomicPut(ctx, pair.Key, pair.Value, nil)
 	} else {
-		_, _, err = c.AtomicPut(pair.Key, pair.Value, pair, nil)
+		err = c.atomicPut(ctx, pair.Key, pair.Value, pair)
 	}
 
 	return err
 }
+
+func (c *nodeNamed) list(ctx context.Context, key string) (pairs []*store.KVPair, err error) {
+	_, span := startStoreSpan(ctx, "list", key)
+	defer func(begin time.Time) {
+		observe("list", begin, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	var res []*store.KVPair
+	err = do(ctx, func() (e error) {
+		res, e = c.List(key)
+		return
+	})
+	if err != nil {
+		return nil, wrapStoreError("list", key, err)
+	}
+	return res, nil
+}
+
+func (c *nodeNamed) get(ctx context.Context, key string) (pair *store.KVPair, err error) {
+	_, span := startStoreSpan(ctx, "get", key)
+	defer func(begin time.Time) {
+		observe("get", begin, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	var res *store.KVPair
+	err = do(ctx, func() (e error) {
+		res, e = c.Get(key)
+		return
+	})
+	if err != nil {
+		return nil, wrapStoreError("get", key, err)
+	}
+	return res, nil
+}
+
+func (c *nodeNamed) atomicPut(ctx context.Context, key string, value []byte, previous *store.KVPair) (err error) {
+	_, span := startStoreSpan(ctx, "atomic_put", key)
+	defer func(begin time.Time) {
+		observe("atomic_put", begin, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	err = do(ctx, func() (e error) {
+		_, _, e = c.AtomicPut(key, value, previous, nil)
+		return
+	})
+	if err == nil {
+		c.mirrorKey(ctx, key)
+	}
+	return wrapStoreError("atomic_put", key, err)
+}
+
+// do 执行一次后端调用, ctx结束时立即返回而不等待调用完成.
+// 被放弃的写入可能仍然成功, 调用方重试时会通过RecoverNodeID找回
+func do(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
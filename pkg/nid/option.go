@@ -0,0 +1,50 @@
+package nid
+
+import "time"
+
+// Option ...
+type Option func(*nodeNamed)
+
+// RetryCount 申请新编号时的最大尝试次数
+func RetryCount(n int) Option {
+	return func(c *nodeNamed) {
+		if n > 0 {
+			c.retryCount = n
+		}
+	}
+}
+
+// OnEvent 注册编号生命周期事件的监听者, 可以注册多个
+func OnEvent(l Listener) Option {
+	return func(c *nodeNamed) {
+		if l != nil {
+			c.listeners = append(c.listeners, l)
+		}
+	}
+}
+
+// IdempotencyWindow 幂等key的保留时间
+func IdempotencyWindow(d time.Duration) Option {
+	return func(c *nodeNamed) {
+		if d > 0 {
+			c.idempotencyWindow = d
+		}
+	}
+}
+
+// HistorySize 每个编号保留的历史持有者数量, 0使用默认值, 负数表示不记录
+func HistorySize(n int) Option {
+	return func(c *nodeNamed) {
+		if n != 0 {
+			c.historySize = n
+		}
+	}
+}
+
+// MirrorTo 每次写入或删除成功后把key同步写入dst, 用于迁移后端期间的双写.
+// 编号、历史、幂等记录以及通过KV写入的注册信息、审计日志都会同步, 失败时通过onError报告
+func MirrorTo(dst KV, onError func(key string, err error)) Option {
+	return func(c *nodeNamed) {
+		c.mirror, c.onMirrorError = dst, onError
+	}
+}
@@ -0,0 +1,81 @@
+package nid
+
+import (
+	"context"
+
+	"github.com/docker/libkv/store"
+	"github.com/pkg/errors"
+)
+
+// ReleaseNodeID 释放holder持有的编号, 没有持有时返回ErrNotFound
+func (c *nodeNamed) ReleaseNodeID(ctx context.Context, holder *NameHolder) (nodeID int, err error) {
+	ctx, span := startSpan(ctx, "nid.ReleaseNodeID", holder)
+	defer func() { endSpan(span, err) }()
+
+	pairs, err := c.listNodes(ctx, holder.ServiceKey)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, pair := range pairs {
+		info := &NameHolder{}
+		if info.DecodeInfo(pair.Value) != nil ||
+			info.LocalIP != holder.LocalIP ||
+			info.LocalPath != holder.LocalPath {
+			continue
+		}
+
+		if err := c.delete(ctx, pair.Key, pair); err != nil {
+			return 0, err
+		}
+
+		nodeID = c.ConvertStringToID(pair.Key)
+		info.ServiceKey = holder.ServiceKey
+		c.emit(ctx, EventReleased, holder.ServiceKey, nodeID, nil, info)
+		return nodeID, nil
+	}
+	return 0, errors.Wrapf(ErrNotFound, "%s is not held by %s:%s", holder.ServiceKey, holder.LocalIP, holder.LocalPath)
+}
+
+// EvictNodeID 不管持有者是谁, 收回服务的编号, 返回原持有者
+func (c *nodeNamed) EvictNodeID(ctx context.Context, serviceKey string, nodeID int) (*NameHolder, error) {
+	key := c.MakeConsulKey(serviceKey, nodeID)
+	pair, err := c.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.delete(ctx, key, pair); err != nil {
+		return nil, err
+	}
+
+	previous := &NameHolder{}
+	if previous.DecodeInfo(pair.Value) != nil {
+		previous = nil
+	} else {
+		previous.ServiceKey = serviceKey
+	}
+	c.emit(ctx, EventEvicted, serviceKey, nodeID, nil, previous)
+	return previous, nil
+}
+
+// ReserveNodeID 为holder占用指定的编号, 编号不在holder.Allocation的范围内时返回ErrOutOfRange, 已被占用时返回ErrConflict
+func (c *nodeNamed) ReserveNodeID(ctx context.Context, holder *NameHolder, nodeID int) (err error) {
+	ctx, span := startSpan(ctx, "nid.ReserveNodeID", holder)
+	defer func() { endSpan(span, err) }()
+
+	if min, max := holder.Allocation.bounds(); nodeID < min || nodeID > max {
+		return errors.Wrapf(ErrOutOfRange, "%d is not in [%d, %d]", nodeID, min, max)
+	}
+
+	key := c.MakeConsulKey(holder.ServiceKey, nodeID)
+	if err := c.TryHold(ctx, &store.KVPair{Key: key}, holder); err != nil {
+		if errors.Is(err, ErrConflict) {
+			return errors.Wrapf(ErrConflict, "%s is already held", key)
+		}
+		return err
+	}
+
+	c.emit(ctx, EventAllocated, holder.ServiceKey, nodeID, holder, nil)
+	return nil
+}
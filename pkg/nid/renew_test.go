@@ -0,0 +1,33 @@
+package nid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenewNodeID(t *testing.T) {
+	ctx := context.Background()
+	var events []string
+	named, err := NewBoltNamed(t.TempDir()+"/node.bolt", OnEvent(func(_ context.Context, ev *Event) {
+		events = append(events, ev.Type)
+	}))
+	assert.NoError(t, err)
+
+	holder := &NameHolder{ServiceKey: "nodeId/foo", LocalIP: "127.0.0.1", LocalPath: "/app"}
+	id, err := named.GetNodeIDContext(ctx, holder)
+	assert.NoError(t, err)
+
+	// 续约不产生事件
+	assert.NoError(t, named.RenewNodeID(ctx, holder, id))
+	assert.Equal(t, []string{EventAllocated}, events)
+
+	other := &NameHolder{ServiceKey: "nodeId/foo", LocalIP: "127.0.0.2", LocalPath: "/app"}
+	assert.True(t, errors.Is(named.RenewNodeID(ctx, other, id), ErrNotFound))
+
+	_, err = named.ReleaseNodeID(ctx, holder)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(named.RenewNodeID(ctx, holder, id), ErrNotFound))
+}
@@ -0,0 +1,210 @@
+package nid
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/libkv/store"
+	"github.com/pkg/errors"
+)
+
+// SnapshotVersion 快照格式的版本, 格式不兼容时增加
+const SnapshotVersion = 1
+
+// 导入时记录已存在的处理方式
+const (
+	ConflictSkip      = "skip"      // 保留已有的记录
+	ConflictOverwrite = "overwrite" // 使用快照中的记录
+	ConflictFail      = "fail"      // 存在冲突时不导入任何记录
+)
+
+// maxReportedConflicts 策略为fail时错误信息中最多列出的key
+const maxReportedConflicts = 10
+
+// Snapshot root下所有编号记录的快照
+type Snapshot struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Root    string    `json:"root"`
+	Records []*Record `json:"records,omitempty"`
+}
+
+// Record 一条编号记录, Value为后端中的原始内容, 其他字段便于查看
+type Record struct {
+	Key        string      `json:"key"`
+	Value      []byte      `json:"value"`
+	Version    uint64      `json:"version"` // 导出时后端的版本号, 导入后由目标后端重新生成
+	ServiceKey string      `json:"serviceKey"`
+	NodeID     int         `json:"nodeId"`
+	Holder     *NameHolder `json:"holder,omitempty"`
+}
+
+// ImportResult 导入的结果, Conflicts为已存在的key
+type ImportResult struct {
+	Created     int      `json:"created"`
+	Overwritten int      `json:"overwritten"`
+	Skipped     int      `json:"skipped"`
+	Conflicts   []string `json:"conflicts,omitempty"`
+}
+
+// Export 导出root下所有服务的编号记录, 按key排序
+func Export(ctx context.Context, kv KV, root string) (*Snapshot, error) {
+	pairs, err := kv.ListKeys(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	snap := &Snapshot{Version: SnapshotVersion, Time: time.Now(), Root: prefix}
+	for _, pair := range pairs {
+		name, ok := childName(pair.Key, prefix)
+		if !ok || strings.Count(name, "/") != 1 {
+			continue
+		}
+		serviceKey, id, ok := ParseNodeKey(prefix + name)
+		if !ok {
+			continue
+		}
+		r := &Record{
+			Key:        prefix + name,
+			Value:      pair.Value,
+			Version:    pair.LastIndex,
+			ServiceKey: serviceKey,
+			NodeID:     id,
+			Holder:     &NameHolder{},
+		}
+		if r.Holder.DecodeInfo(pair.Value) != nil {
+			r.Holder = nil
+		}
+		snap.Records = append(snap.Records, r)
+	}
+
+	sort.Slice(snap.Records, func(i, j int) bool { return snap.Records[i].Key < snap.Records[j].Key })
+	return snap, nil
+}
+
+// ParseNodeKey 解析<serviceKey>/node_<id>形式的key, id必须是规范的十进制数
+func ParseNodeKey(key string) (serviceKey string, nodeID int, ok bool) {
+	i := strings.LastIndex(key, "/")
+	if i <= 0 || !strings.HasPrefix(key[i+1:], nodePrefix) {
+		return "", 0, false
+	}
+	s := strings.TrimPrefix(key[i+1:], nodePrefix)
+	id, err := strconv.Atoi(s)
+	if err != nil || strconv.Itoa(id) != s {
+		return "", 0, false
+	}
+	return key[:i], id, true
+}
+
+// Check 检查记录的key和内容, alloc为记录所属服务的分配规则, 编号需要在其范围内
+func (r *Record) Check(alloc *Allocation) error {
+	_, id, ok := ParseNodeKey(r.Key)
+	if !ok {
+		return errors.Errorf("record %s is not a node key", r.Key)
+	}
+	if min, max := alloc.bounds(); id < min || id > max {
+		return errors.Wrapf(ErrOutOfRange, "record %s: id %d is out of range [%d, %d]", r.Key, id, min, max)
+	}
+	if err := (&NameHolder{}).DecodeInfo(r.Value); err != nil {
+		return errors.Wrapf(err, "record %s", r.Key)
+	}
+	return nil
+}
+
+// Import 按快照写入记录, 记录已存在时按policy处理.
+// 不会删除快照中没有的记录, 也不触发事件
+func Import(ctx context.Context, kv KV, records []*Record, policy string) (*ImportResult, error) {
+	switch policy {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return nil, errors.Errorf("unknown conflict policy %q", policy)
+	}
+
+	existing := make(map[string]*store.KVPair)
+	result := &ImportResult{}
+	for _, r := range records {
+		pair, err := kv.GetKey(ctx, r.Key)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		existing[r.Key] = pair
+		result.Conflicts = append(result.Conflicts, r.Key)
+	}
+	if policy == ConflictFail && len(result.Conflicts) > 0 {
+		keys := result.Conflicts
+		if len(keys) > maxReportedConflicts {
+			keys = append(keys[:maxReportedConflicts:maxReportedConflicts], "...")
+		}
+		return result, errors.Wrapf(ErrConflict, "%d records already exist: %s", len(result.Conflicts), strings.Join(keys, ", "))
+	}
+
+	for _, r := range records {
+		pair, ok := existing[r.Key]
+		switch {
+		case !ok:
+			if err := kv.PutKey(ctx, r.Key, r.Value, nil); err != nil {
+				return result, err
+			}
+			result.Created++
+		case policy == ConflictSkip:
+			result.Skipped++
+		default:
+			if err := kv.PutKey(ctx, r.Key, r.Value, pair); err != nil {
+				return result, err
+			}
+			result.Overwritten++
+		}
+	}
+	return result, nil
+}
+
+// WriteSnapshot ndjson为true时第一行为不含记录的快照信息, 之后每行一条记录
+func WriteSnapshot(w io.Writer, snap *Snapshot, ndjson bool) error {
+	enc := json.NewEncoder(w)
+	if !ndjson {
+		enc.SetIndent("", "  ")
+		return enc.Encode(snap)
+	}
+
+	header := *snap
+	header.Records = nil
+	if err := enc.Encode(&header); err != nil {
+		return err
+	}
+	for _, r := range snap.Records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSnapshot 读取json或ndjson格式的快照
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	dec := json.NewDecoder(r)
+	snap := &Snapshot{}
+	if err := dec.Decode(snap); err != nil {
+		return nil, errors.Wrap(err, "decode snapshot")
+	}
+	if snap.Version != SnapshotVersion {
+		return nil, errors.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	for dec.More() {
+		record := &Record{}
+		if err := dec.Decode(record); err != nil {
+			return nil, errors.Wrap(err, "decode snapshot record")
+		}
+		snap.Records = append(snap.Records, record)
+	}
+	return snap, nil
+}
@@ -0,0 +1,42 @@
+package nid
+
+import (
+	"context"
+
+	"github.com/docker/libkv/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("nodeid/pkg/nid")
+
+func startSpan(ctx context.Context, name string, holder *NameHolder) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("nodeid.service", holder.ServiceKey),
+		attribute.String("nodeid.holder.ip", holder.LocalIP),
+		attribute.String("nodeid.holder.path", holder.LocalPath),
+	))
+}
+
+func startStoreSpan(ctx context.Context, op, key string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "store."+op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("nodeid.key", key)))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// key不存在属于正常情况, 不标记为错误
+func endStoreSpan(span trace.Span, err error) {
+	if err == store.ErrKeyNotFound {
+		err = nil
+	}
+	endSpan(span, err)
+}